@@ -0,0 +1,912 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveFormat is a format of archives, which can be compared and opened as file systems.
+type ArchiveFormat int
+
+const (
+	ArchiveUnknown ArchiveFormat = iota
+	ArchiveTar
+	ArchiveTarGzip
+	ArchiveZip
+)
+
+var archiveFormatNames = map[ArchiveFormat]string{
+	ArchiveUnknown: "unknown",
+	ArchiveTar:     "tar",
+	ArchiveTarGzip: "tar.gz",
+	ArchiveZip:     "zip",
+}
+
+func (f ArchiveFormat) String() string {
+	if name, ok := archiveFormatNames[f]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ArchiveFormat(%d)", int(f))
+}
+
+// ArchiveFormatOf tells the archive format by the file name extension:
+// ".tar", ".tar.gz", ".tgz" or ".zip", case-insensitively.
+func ArchiveFormatOf(name string) ArchiveFormat {
+	name = strings.ToLower(name)
+
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGzip
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip
+	default:
+		return ArchiveUnknown
+	}
+}
+
+// Detects the format by the magic numbers and falls back to the extension,
+// because old tar archives have no magic number.
+func detectArchiveFormat(file *os.File) (ArchiveFormat, error) {
+	header := make([]byte, 512)
+
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != EOF {
+		return ArchiveUnknown, err
+	}
+
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ArchiveTarGzip, nil
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	case len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar")):
+		return ArchiveTar, nil
+	}
+
+	if format := ArchiveFormatOf(file.Name()); format == ArchiveTar {
+		return format, nil
+	}
+
+	return ArchiveUnknown, &PathError{Op: "open archive", Path: file.Name(), Err: ErrUnknownArchiveFormat}
+}
+
+// Archive is a read-only file system of archive entries, which is safe for concurrent use.
+// Names of entries are cleaned, so leading "/" and "./" are dropped.
+// Parent directories, missing in the archive, are implied.
+// Hard links of tar archives are read as regular files with the contents of their targets.
+type Archive struct {
+	format  ArchiveFormat
+	entries map[string]*archiveEntry
+
+	// Files to close, when the archive is closed.
+	closers []io.Closer
+	closed  bool
+}
+
+type archiveEntry struct {
+	name    string
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+	sys     interface{}
+
+	// Target of a symbolic link or of a tar hard link.
+	link string
+
+	// Opens contents of a regular file.
+	open func() (io.ReadCloser, error)
+
+	// Sorted names of children of a directory.
+	children []string
+}
+
+// OpenArchive opens a tar, a gzip-compressed tar or a zip archive, detecting its format by contents.
+// Only entry headers are read, so contents of files are read, when they are opened.
+// Files of a gzip-compressed tar are read by decompressing the archive from the start,
+// unless they are opened in the archive order, so nothing is decompressed into memory or temporary files.
+func OpenArchive(path string) (*Archive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{entries: make(map[string]*archiveEntry)}
+
+	if a.format, err = detectArchiveFormat(file); err == nil {
+		switch a.format {
+		case ArchiveZip:
+			err = a.readZip(file)
+		case ArchiveTarGzip:
+			err = a.readTarGzip(file)
+		default:
+			a.closers = append(a.closers, file)
+			err = a.readTar(file)
+		}
+	}
+
+	if err == nil {
+		err = a.index()
+	}
+
+	if err != nil {
+		closeQuietly(file)
+		closeQuietly(a)
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Format returns the detected format of the archive.
+func (a *Archive) Format() ArchiveFormat {
+	return a.format
+}
+
+// Close closes the archive file.
+func (a *Archive) Close() error {
+	err := closeAll(a.closers...)
+	a.closers = nil
+	a.closed = true
+	return err
+}
+
+func (a *Archive) readZip(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	r, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	a.closers = append(a.closers, file)
+
+	for _, f := range r.File {
+		f := f
+
+		entry := &archiveEntry{
+			mode:    f.Mode(),
+			size:    int64(f.UncompressedSize64),
+			modTime: f.Modified,
+			sys:     &f.FileHeader,
+			open: func() (io.ReadCloser, error) {
+				return f.Open()
+			},
+		}
+
+		if entry.mode&fs.ModeSymlink != 0 {
+			target, err := readZipLink(f)
+			if err != nil {
+				return err
+			}
+
+			entry.link = target
+		}
+
+		if err := a.add(f.Name, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Symbolic links of zip archives store their targets as contents.
+func readZipLink(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+
+	target, err := ioutil.ReadAll(io.LimitReader(r, 4<<10))
+	if err != nil {
+		closeQuietly(r)
+		return "", err
+	}
+
+	return string(target), r.Close()
+}
+
+// Contents of a gzip-compressed tar cannot be read at offsets, so only headers are indexed,
+// and entries are read by decompressing the stream again, see tarGzipStream.
+func (a *Archive) readTarGzip(file *os.File) error {
+	a.closers = append(a.closers, file)
+
+	stream := &tarGzipStream{file: file}
+
+	r, err := stream.reset()
+	if err != nil {
+		return err
+	}
+
+	return a.readTarEntries(r, func(header *tar.Header, index int) func() (io.ReadCloser, error) {
+		return func() (io.ReadCloser, error) {
+			return stream.open(index)
+		}
+	})
+}
+
+func (a *Archive) readTar(file *os.File) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// The counter tells offsets of file contents, so they are read directly from the file, when opened.
+	counter := &countingReader{r: file}
+
+	return a.readTarEntries(tar.NewReader(counter), func(header *tar.Header, index int) func() (io.ReadCloser, error) {
+		section := io.NewSectionReader(file, counter.n, header.Size)
+
+		return func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(io.NewSectionReader(section, 0, section.Size())), nil
+		}
+	})
+}
+
+// Adds entries of the tar stream. The open function makes an opener of contents of the regular file,
+// whose header is the index-th one of the stream, and the reader is positioned at the contents.
+func (a *Archive) readTarEntries(
+	r *tar.Reader,
+	open func(header *tar.Header, index int) func() (io.ReadCloser, error),
+) error {
+	for index := 0; ; index++ {
+		header, err := r.Next()
+		if err == EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		info := header.FileInfo()
+
+		entry := &archiveEntry{
+			mode:    info.Mode(),
+			size:    info.Size(),
+			modTime: header.ModTime,
+			sys:     header,
+		}
+
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			entry.link = header.Linkname
+		case tar.TypeLink:
+			if entry.link, err = cleanArchiveName(header.Linkname); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+			if isSparseTarHeader(header) {
+				contents, err := ioutil.ReadAll(r)
+				if err != nil {
+					return err
+				}
+
+				entry.size = int64(len(contents))
+				entry.open = func() (io.ReadCloser, error) {
+					return ioutil.NopCloser(bytes.NewReader(contents)), nil
+				}
+			} else {
+				entry.open = open(header, index)
+			}
+		}
+
+		if err := a.add(header.Name, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// tarGzipStream reads entries of a gzip-compressed tar file by decompressing it from the start.
+// The reader of the last closed entry is kept, so entries opened in the archive order are read in a single pass.
+type tarGzipStream struct {
+	file *os.File
+
+	mu     sync.Mutex
+	cursor *tar.Reader
+	// Index of the next header of the cursor.
+	next int
+}
+
+// Returns a new reader of the stream from the start.
+func (s *tarGzipStream) reset() (*tar.Reader, error) {
+	// A section reader reads at offsets, so concurrent readers do not share the file offset.
+	gzipReader, err := gzip.NewReader(io.NewSectionReader(s.file, 0, math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+
+	return tar.NewReader(gzipReader), nil
+}
+
+func (s *tarGzipStream) open(index int) (io.ReadCloser, error) {
+	s.mu.Lock()
+	r, next := s.cursor, s.next
+	s.cursor = nil
+	s.mu.Unlock()
+
+	if r == nil || next > index {
+		var err error
+		if r, err = s.reset(); err != nil {
+			return nil, err
+		}
+
+		next = 0
+	}
+
+	for ; next <= index; next++ {
+		if _, err := r.Next(); err != nil {
+			if err == EOF {
+				// The archive has been changed since it was opened.
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, err
+		}
+	}
+
+	return &tarGzipEntry{stream: s, r: r, next: next}, nil
+}
+
+type tarGzipEntry struct {
+	stream *tarGzipStream
+	r      *tar.Reader
+	next   int
+}
+
+func (e *tarGzipEntry) Read(buf []byte) (int, error) {
+	if e.r == nil {
+		return 0, fs.ErrClosed
+	}
+
+	return e.r.Read(buf)
+}
+
+// Close returns the reader to the stream, so the next entries are read without decompressing the previous ones.
+func (e *tarGzipEntry) Close() error {
+	if e.r == nil {
+		return fs.ErrClosed
+	}
+
+	e.stream.mu.Lock()
+	if e.stream.cursor == nil {
+		e.stream.cursor, e.stream.next = e.r, e.next
+	}
+	e.stream.mu.Unlock()
+
+	e.r = nil
+	return nil
+}
+
+func isSparseTarHeader(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	r.n += int64(n)
+	return n, err
+}
+
+// Cleans the entry name, so it is valid for fs.ValidPath, or returns ErrUnsafeArchivePath,
+// if the name refers to a parent directory.
+// Leading slashes are dropped, like tar does by default.
+func cleanArchiveName(name string) (string, error) {
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", &PathError{Op: "open archive", Path: name, Err: ErrUnsafeArchivePath}
+		}
+	}
+
+	if name = path.Clean("/" + name)[1:]; name == "" {
+		name = "."
+	}
+
+	return name, nil
+}
+
+// Adds the entry, replacing the existing one, like extracting tar archives does.
+func (a *Archive) add(name string, entry *archiveEntry) error {
+	name, err := cleanArchiveName(name)
+	if err != nil {
+		return err
+	}
+
+	entry.name = name
+	a.entries[name] = entry
+	return nil
+}
+
+// Resolves hard links, implies missing directories and collects children of directories.
+func (a *Archive) index() error {
+	for _, entry := range a.entries {
+		if err := a.resolveHardLink(entry); err != nil {
+			return err
+		}
+	}
+
+	if root, ok := a.entries["."]; !ok || !root.mode.IsDir() {
+		a.entries["."] = &archiveEntry{name: ".", mode: fs.ModeDir | 0755}
+	}
+
+	names := make([]string, 0, len(a.entries))
+	for name := range a.entries {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "." {
+			continue
+		}
+
+		for child := name; ; {
+			parentName := path.Dir(child)
+
+			parent, ok := a.entries[parentName]
+			if !ok {
+				parent = &archiveEntry{name: parentName, mode: fs.ModeDir | 0755}
+				a.entries[parentName] = parent
+			} else if !parent.mode.IsDir() {
+				return &PathError{Op: "open archive", Path: name, Err: ErrNotDir}
+			}
+
+			parent.children = append(parent.children, path.Base(child))
+
+			if ok || parentName == "." {
+				break
+			}
+
+			child = parentName
+		}
+	}
+
+	for _, entry := range a.entries {
+		sort.Strings(entry.children)
+	}
+
+	return nil
+}
+
+// Makes the tar hard link read contents of its target, which may be a hard link too.
+func (a *Archive) resolveHardLink(entry *archiveEntry) error {
+	target := entry
+
+	for hops := 0; target.link != "" && target.mode&fs.ModeSymlink == 0; hops++ {
+		if hops > DefaultMaxSymlinkHops {
+			return &PathError{Op: "open archive", Path: entry.name, Err: ErrSymlinkLoop}
+		}
+
+		var ok bool
+		if target, ok = a.entries[target.link]; !ok || !target.mode.IsRegular() {
+			return &PathError{Op: "open archive", Path: entry.name, Err: fs.ErrNotExist}
+		}
+	}
+
+	entry.size, entry.open = target.size, target.open
+	return nil
+}
+
+// Finds the entry by the name, resolving symbolic links of parent directories,
+// as well as of the entry itself, if requested.
+// Symbolic links with absolute targets or targets outside of the archive are treated as dangling.
+func (a *Archive) lookup(op, name string, follow bool) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return a.entries["."], nil
+	}
+
+	parts := strings.Split(name, "/")
+	current := "."
+	hops := 0
+
+	for i := 0; i < len(parts); i++ {
+		next := path.Join(current, parts[i])
+
+		entry, ok := a.entries[next]
+		if !ok {
+			return nil, &PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+
+		last := i == len(parts)-1
+
+		if entry.mode&fs.ModeSymlink != 0 && (follow || !last) {
+			if hops++; hops > DefaultMaxSymlinkHops {
+				return nil, &PathError{Op: op, Path: name, Err: ErrSymlinkLoop}
+			}
+
+			target := path.Join(path.Dir(next), entry.link)
+			if path.IsAbs(entry.link) || !fs.ValidPath(target) {
+				return nil, &PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+
+			// Continue from the root with the target and the rest of the name.
+			rest := parts[i+1:]
+			parts = nil
+			if target != "." {
+				parts = strings.Split(target, "/")
+			}
+
+			parts = append(parts, rest...)
+			current = "."
+			i = -1
+
+			if len(parts) == 0 {
+				return a.entries["."], nil
+			}
+
+			continue
+		}
+
+		if !last && !entry.mode.IsDir() {
+			return nil, &PathError{Op: op, Path: name, Err: ErrNotDir}
+		}
+
+		current = next
+
+		if last {
+			return entry, nil
+		}
+	}
+
+	return a.entries[current], nil
+}
+
+// Open opens the entry, following symbolic links. Directories implement fs.ReadDirFile.
+func (a *Archive) Open(name string) (fs.File, error) {
+	if a.closed {
+		return nil, &PathError{Op: "open", Path: name, Err: fs.ErrClosed}
+	}
+
+	entry, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	info := entry.info(path.Base(name))
+
+	if entry.mode.IsDir() {
+		return &archiveDir{archive: a, entry: entry, info: info}, nil
+	}
+
+	if entry.open == nil {
+		return nil, errUnsupportedPathType("open", name)
+	}
+
+	r, err := entry.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveFile{ReadCloser: r, info: info}, nil
+}
+
+// Stat describes the entry, following symbolic links.
+func (a *Archive) Stat(name string) (fs.FileInfo, error) {
+	entry, err := a.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.info(path.Base(name)), nil
+}
+
+// Lstat describes the entry without following it, if it is a symbolic link.
+func (a *Archive) Lstat(name string) (fs.FileInfo, error) {
+	entry, err := a.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.info(path.Base(name)), nil
+}
+
+// ReadLink returns the target of the symbolic link as is.
+func (a *Archive) ReadLink(name string) (string, error) {
+	entry, err := a.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+
+	if entry.mode&fs.ModeSymlink == 0 {
+		return "", &PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return entry.link, nil
+}
+
+// ReadDir returns children of the directory sorted by names.
+func (a *Archive) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := a.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.mode.IsDir() {
+		return nil, errNotDir("readdir", name)
+	}
+
+	return a.dirEntries(entry), nil
+}
+
+func (a *Archive) dirEntries(dir *archiveEntry) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(dir.children))
+
+	for _, child := range dir.children {
+		entry := a.entries[path.Join(dir.name, child)]
+		entries = append(entries, fs.FileInfoToDirEntry(entry.info(child)))
+	}
+
+	return entries
+}
+
+func (e *archiveEntry) info(name string) fs.FileInfo {
+	return &archiveFileInfo{entry: e, name: name}
+}
+
+// archiveFileInfo describes an entry under the name it was requested by, which differs for symbolic links.
+type archiveFileInfo struct {
+	entry *archiveEntry
+	name  string
+}
+
+func (i *archiveFileInfo) Name() string {
+	return i.name
+}
+
+func (i *archiveFileInfo) Size() int64 {
+	return i.entry.size
+}
+
+func (i *archiveFileInfo) Mode() fs.FileMode {
+	return i.entry.mode
+}
+
+func (i *archiveFileInfo) ModTime() time.Time {
+	return i.entry.modTime
+}
+
+func (i *archiveFileInfo) IsDir() bool {
+	return i.entry.mode.IsDir()
+}
+
+func (i *archiveFileInfo) Sys() interface{} {
+	return i.entry.sys
+}
+
+type archiveFile struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+type archiveDir struct {
+	archive *Archive
+	entry   *archiveEntry
+	info    fs.FileInfo
+
+	// Entries not yet returned by ReadDir.
+	rest []fs.DirEntry
+	read bool
+}
+
+func (d *archiveDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *archiveDir) Read([]byte) (int, error) {
+	return 0, &PathError{Op: "read", Path: d.entry.name, Err: fs.ErrInvalid}
+}
+
+func (d *archiveDir) Close() error {
+	return nil
+}
+
+func (d *archiveDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.rest, d.read = d.archive.dirEntries(d.entry), true
+	}
+
+	if n <= 0 {
+		entries := d.rest
+		d.rest = nil
+		return entries, nil
+	}
+
+	if len(d.rest) == 0 {
+		return nil, EOF
+	}
+
+	if n > len(d.rest) {
+		n = len(d.rest)
+	}
+
+	entries := d.rest[:n]
+	d.rest = d.rest[n:]
+	return entries, nil
+}
+
+// ----------------------------------------------------------------------------------------------------
+
+type ArchiveCompareOptions struct {
+	// Options of the comparison.
+	Compare CompareOptions
+
+	// Slash-separated directories inside archives to compare instead of their roots, e.g. "app-1.0".
+	// They are ignored for directories.
+	Root1 string
+	Root2 string
+}
+
+// ArchivesEqual compares two directory trees, either of which may be a tar, a gzip-compressed tar or a zip archive.
+// See ArchivesEqualContext for details.
+func ArchivesEqual(path1, path2 string) (equal bool, err error) {
+	return ArchivesEqualContext(context.Background(), path1, path2, ArchiveCompareOptions{})
+}
+
+// ArchivesEqualContext is the same as DirsEqualContext, but either path may be an archive,
+// which is read directly without extraction, see OpenArchive.
+// Digests of archive entries are never cached.
+func ArchivesEqualContext(ctx context.Context, path1, path2 string, opts ArchiveCompareOptions) (equal bool, err error) {
+	err = walkArchiveDiffs(ctx, path1, path2, &opts, nil, &equal)
+	return
+}
+
+// DiffArchives is the same as DiffDirs, but either path may be an archive.
+// Full paths of archive diff items are names in the archives. See ArchivesEqualContext for details.
+func DiffArchives(path1, path2 string) (diffs []Diff, err error) {
+	return DiffArchivesContext(context.Background(), path1, path2, ArchiveCompareOptions{})
+}
+
+// DiffArchivesContext is the same as DiffDirsContext, but either path may be an archive.
+func DiffArchivesContext(ctx context.Context, path1, path2 string, opts ArchiveCompareOptions) (diffs []Diff, err error) {
+	err = WalkDiffsArchivesContext(ctx, path1, path2, opts, func(diff Diff) error {
+		diffs = append(diffs, diff)
+		return nil
+	})
+
+	return
+}
+
+// WalkDiffsArchivesContext is the same as WalkDiffsContext, but either path may be an archive.
+func WalkDiffsArchivesContext(
+	ctx context.Context,
+	path1 string,
+	path2 string,
+	opts ArchiveCompareOptions,
+	fn WalkDiffFunc,
+) error {
+	if err := walkArchiveDiffs(ctx, path1, path2, &opts, fn, nil); err != nil && err != SkipAll {
+		return err
+	}
+
+	return nil
+}
+
+func walkArchiveDiffs(
+	ctx context.Context,
+	path1 string,
+	path2 string,
+	opts *ArchiveCompareOptions,
+	fn WalkDiffFunc,
+	equal *bool,
+) (err error) {
+	if err := opts.Compare.validate(); err != nil {
+		return err
+	}
+
+	tree1, root1, err := openArchiveTree(path1, opts.Root1)
+	if err != nil {
+		return err
+	}
+
+	defer CloseInto(&err, tree1)
+
+	tree2, root2, err := openArchiveTree(path2, opts.Root2)
+	if err != nil {
+		return err
+	}
+
+	defer CloseInto(&err, tree2)
+
+	result, err := treesEqual(ctx, tree1, root1, tree2, root2, &opts.Compare, fn)
+	if equal != nil {
+		*equal = result
+	}
+
+	return err
+}
+
+// closableTree is a tree, which must be closed after the comparison.
+type closableTree interface {
+	tree
+	io.Closer
+}
+
+type osClosableTree struct {
+	osTree
+}
+
+func (osClosableTree) Close() error {
+	return nil
+}
+
+type archiveTree struct {
+	fsTree
+}
+
+func (t archiveTree) Close() error {
+	return t.fsys.(*Archive).Close()
+}
+
+// Opens the path as a directory of the OS file system, if it is one, or as an archive otherwise.
+func openArchiveTree(p, root string) (closableTree, string, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if info.IsDir() {
+		return osClosableTree{}, p, nil
+	}
+
+	if root == "" {
+		root = "."
+	}
+
+	if !fs.ValidPath(root) {
+		return nil, "", &PathError{Op: "compare", Path: root, Err: fs.ErrInvalid}
+	}
+
+	archive, err := OpenArchive(p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return archiveTree{fsTree{fsys: archive}}, root, nil
+}
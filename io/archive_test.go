@@ -0,0 +1,349 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes the directory tree into the archive under the prefix, e.g. "./" or "app/".
+func writeTestArchive(t *testing.T, dir, prefix, archivePath string) {
+	t.Helper()
+
+	file, err := os.Create(archivePath)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	defer closeQuietly(file)
+
+	format := ArchiveFormatOf(archivePath)
+
+	var gzipWriter *gzip.Writer
+	var tarWriter *tar.Writer
+	var zipWriter *zip.Writer
+
+	switch format {
+	case ArchiveTarGzip:
+		gzipWriter = gzip.NewWriter(file)
+		tarWriter = tar.NewWriter(gzipWriter)
+	case ArchiveTar:
+		tarWriter = tar.NewWriter(file)
+	default:
+		zipWriter = zip.NewWriter(file)
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		name := prefix + filepath.ToSlash(rel)
+		if info.IsDir() {
+			name += "/"
+		}
+
+		var contents []byte
+		if !info.IsDir() {
+			if contents, err = os.ReadFile(path); err != nil {
+				return err
+			}
+		}
+
+		if tarWriter != nil {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+
+			header.Name = name
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+
+			_, err = tarWriter.Write(contents)
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+		w, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(contents)
+		return err
+	})
+
+	if assert.Nil(t, err) {
+		if tarWriter != nil {
+			assert.Nil(t, tarWriter.Close())
+		} else {
+			assert.Nil(t, zipWriter.Close())
+		}
+
+		if gzipWriter != nil {
+			assert.Nil(t, gzipWriter.Close())
+		}
+	}
+}
+
+// Writes the tar archive with the headers, whose contents are their link names for regular files.
+func writeTestTar(t *testing.T, archivePath string, headers ...*tar.Header) {
+	t.Helper()
+
+	file, err := os.Create(archivePath)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	defer closeQuietly(file)
+
+	w := tar.NewWriter(file)
+
+	for _, header := range headers {
+		var contents []byte
+		if header.Typeflag == tar.TypeReg {
+			contents = []byte(header.Linkname)
+			header.Linkname, header.Size = "", int64(len(contents))
+		}
+
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+
+		if !assert.Nil(t, w.WriteHeader(header)) {
+			t.FailNow()
+		}
+
+		_, err := w.Write(contents)
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, w.Close())
+}
+
+func TestArchivesEqual(t *testing.T) {
+	tempDir := t.TempDir()
+
+	expected, err := DiffDirs(diffPath("c1"), diffPath("c2"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	for _, name := range []string{"c1.tar", "c1.tar.gz", "c1.zip"} {
+		archivePath := filepath.Join(tempDir, name)
+		writeTestArchive(t, diffPath("c1"), "./", archivePath)
+
+		archive, err := OpenArchive(archivePath)
+		if assert.Nil(t, err, name) {
+			assert.Equal(t, ArchiveFormatOf(name), archive.Format())
+			assert.Nil(t, archive.Close())
+		}
+
+		equal, err := ArchivesEqual(archivePath, diffPath("c1"))
+		assert.Nil(t, err, name)
+		assert.True(t, equal, name)
+
+		diffs, err := DiffArchivesContext(context.Background(), archivePath, diffPath("c2"), ArchiveCompareOptions{
+			Compare: CompareOptions{Workers: 4},
+		})
+
+		if assert.Nil(t, err, name) && assert.Equal(t, len(expected), len(diffs), name) {
+			for i, diff := range diffs {
+				assert.Equal(t, expected[i].Kind, diff.Kind, diff.Path)
+				assert.Equal(t, expected[i].Path, diff.Path)
+			}
+		}
+	}
+
+	// Archives of different formats, one with a top directory.
+	writeTestArchive(t, diffPath("a1"), "a1/", filepath.Join(tempDir, "a1.zip"))
+	writeTestArchive(t, diffPath("a2"), "", filepath.Join(tempDir, "a2.tgz"))
+
+	equal, err := ArchivesEqualContext(context.Background(), filepath.Join(tempDir, "a1.zip"), filepath.Join(tempDir, "a2.tgz"), ArchiveCompareOptions{
+		Root1: "a1",
+	})
+
+	assert.Nil(t, err)
+	assert.True(t, equal)
+
+	equal, err = ArchivesEqual(filepath.Join(tempDir, "a1.zip"), filepath.Join(tempDir, "a2.tgz"))
+	assert.Nil(t, err)
+	assert.False(t, equal)
+}
+
+func TestOpenArchive_FS(t *testing.T) {
+	tempDir := t.TempDir()
+	archivePath := filepath.Join(tempDir, "test.tar")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	writeTestTar(
+		t,
+		archivePath,
+		&tar.Header{Typeflag: tar.TypeReg, Name: "/a/b/file.txt", Linkname: "file", ModTime: modTime},
+		&tar.Header{Typeflag: tar.TypeDir, Name: "./c/", Mode: 0700, ModTime: modTime},
+		&tar.Header{Typeflag: tar.TypeLink, Name: "c/hard.txt", Linkname: "a/b/file.txt"},
+		&tar.Header{Typeflag: tar.TypeLink, Name: "c/hard2.txt", Linkname: "c/hard.txt"},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "c/link", Linkname: "../a/b"},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "c/replaced.txt", Linkname: "old"},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "c/replaced.txt", Linkname: "new"},
+	)
+
+	// Entries of a gzip-compressed tar are read in any order too.
+	contents, err := ioutil.ReadFile(archivePath)
+	assert.Nil(t, err)
+
+	var gzipBuf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipBuf)
+	_, err = gzipWriter.Write(contents)
+	assert.Nil(t, err)
+	assert.Nil(t, gzipWriter.Close())
+
+	gzipPath := filepath.Join(tempDir, "test.tar.gz")
+	assert.Nil(t, os.WriteFile(gzipPath, gzipBuf.Bytes(), 0644))
+
+	testOpenArchiveFS(t, archivePath, modTime)
+	testOpenArchiveFS(t, gzipPath, modTime)
+}
+
+func testOpenArchiveFS(t *testing.T, archivePath string, modTime time.Time) {
+	t.Helper()
+
+	archive, err := OpenArchive(archivePath)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	defer closeQuietly(archive)
+
+	assert.Nil(t, fstest.TestFS(
+		archive,
+		"a/b/file.txt",
+		"c/hard.txt",
+		"c/hard2.txt",
+		"c/replaced.txt",
+	))
+
+	for name, expected := range map[string]string{
+		"c/hard.txt":      "file",
+		"c/hard2.txt":     "file",
+		"c/link/file.txt": "file",
+		"c/replaced.txt":  "new",
+	} {
+		contents, err := fs.ReadFile(archive, name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, string(contents), name)
+	}
+
+	// Files are read independently, while both are open.
+	file1, err := archive.Open("c/replaced.txt")
+	assert.Nil(t, err)
+	file2, err := archive.Open("a/b/file.txt")
+	assert.Nil(t, err)
+
+	if file1 != nil && file2 != nil {
+		contents2, err := ioutil.ReadAll(file2)
+		assert.Nil(t, err)
+		assert.Equal(t, "file", string(contents2))
+
+		contents1, err := ioutil.ReadAll(file1)
+		assert.Nil(t, err)
+		assert.Equal(t, "new", string(contents1))
+
+		assert.Nil(t, closeAll(file1, file2))
+	}
+
+	info, err := archive.Stat("c")
+	if assert.Nil(t, err) {
+		assert.Equal(t, fs.ModeDir|0700, info.Mode())
+		assert.True(t, modTime.Equal(info.ModTime()))
+	}
+
+	info, err = archive.Lstat("c/link")
+	if assert.Nil(t, err) {
+		assert.Equal(t, fs.ModeSymlink, info.Mode().Type())
+	}
+
+	target, err := archive.ReadLink("c/link")
+	assert.Nil(t, err)
+	assert.Equal(t, "../a/b", target)
+
+	_, err = archive.ReadLink("c/hard.txt")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
+
+func TestOpenArchive_Errors(t *testing.T) {
+	tempDir := t.TempDir()
+
+	unsafePath := filepath.Join(tempDir, "unsafe.tar")
+	writeTestTar(t, unsafePath, &tar.Header{Typeflag: tar.TypeReg, Name: "a/../../x", Linkname: "x"})
+
+	_, err := OpenArchive(unsafePath)
+	assert.ErrorIs(t, err, ErrUnsafeArchivePath)
+
+	_, err = ArchivesEqual(unsafePath, diffPath("a1"))
+	assert.ErrorIs(t, err, ErrUnsafeArchivePath)
+
+	linksPath := filepath.Join(tempDir, "links.tar")
+	writeTestTar(
+		t,
+		linksPath,
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "loop", Linkname: "loop"},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "outside", Linkname: "../x"},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "absolute", Linkname: "/etc"},
+	)
+
+	archive, err := OpenArchive(linksPath)
+	if assert.Nil(t, err) {
+		_, err = archive.Stat("loop")
+		assert.ErrorIs(t, err, ErrSymlinkLoop)
+
+		_, err = archive.Stat("outside")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+
+		_, err = archive.Open("absolute/passwd")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+
+		assert.Nil(t, archive.Close())
+	}
+
+	danglingPath := filepath.Join(tempDir, "dangling.tar")
+	writeTestTar(t, danglingPath, &tar.Header{Typeflag: tar.TypeLink, Name: "x", Linkname: "y"})
+
+	_, err = OpenArchive(danglingPath)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = OpenArchive(diffPath("a1/0.bin"))
+	assert.ErrorIs(t, err, ErrUnknownArchiveFormat)
+
+	var pathErr *PathError
+	if assert.True(t, errors.As(err, &pathErr)) {
+		assert.Equal(t, diffPath("a1/0.bin"), pathErr.Path)
+	}
+
+	_, err = ArchivesEqualContext(context.Background(), unsafePath, diffPath("a1"), ArchiveCompareOptions{Root1: "/a"})
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
@@ -0,0 +1,135 @@
+package io
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ io.WriteCloser = (*AtomicWriter)(nil)
+
+// AtomicWriter writes into a temporary file next to the target one and renames it over the target on Close,
+// so readers, as well as the target after a crash, see either the old content or the new one, but never a mix.
+//
+// Either Close or Abort must be called. A usual pattern is to defer Abort, which does nothing after Close:
+//
+//	w, err := NewAtomicWriter(path, 0644)
+//	if err != nil {
+//		return err
+//	}
+//	defer w.Abort()
+//
+//	if _, err := w.Write(data); err != nil {
+//		return err
+//	}
+//
+//	return w.Close()
+type AtomicWriter struct {
+	path string
+	perm os.FileMode
+	file *os.File
+	done bool
+}
+
+// NewAtomicWriter creates a temporary file in the directory of the path, which must exist.
+// The permissions are applied on Close as is, regardless of umask.
+func NewAtomicWriter(path string, perm os.FileMode) (*AtomicWriter, error) {
+	dir, err := parent(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &AtomicWriter{path: path, perm: perm, file: file}, nil
+}
+
+func (w *AtomicWriter) Write(p []byte) (n int, err error) {
+	if w.done {
+		return 0, os.ErrClosed
+	}
+
+	return w.file.Write(p)
+}
+
+// Name returns the path of the temporary file.
+func (w *AtomicWriter) Name() string {
+	return w.file.Name()
+}
+
+// Close flushes the temporary file to the disk, renames it over the target and flushes the parent directory.
+// If anything fails before the rename, the temporary file is removed, and the target is left intact.
+// If only flushing the directory fails, the error is returned, but the target already has the new content,
+// which may not survive a crash.
+// Close returns os.ErrClosed, if the writer is already closed or aborted.
+func (w *AtomicWriter) Close() error {
+	if w.done {
+		return os.ErrClosed
+	}
+
+	w.done = true
+
+	if err := w.replace(); err != nil {
+		// The temporary file still exists, because it has not been renamed.
+		closeQuietly(w.file)
+		_ = os.Remove(w.file.Name())
+		return err
+	}
+
+	// The rename itself is durable only after the directory is flushed.
+	return syncDir(filepath.Dir(w.file.Name()))
+}
+
+// Flushes and closes the temporary file and renames it over the target.
+func (w *AtomicWriter) replace() error {
+	if err := w.file.Chmod(w.perm); err != nil {
+		return err
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(w.file.Name(), w.path)
+}
+
+// Abort closes and removes the temporary file, leaving the target intact.
+// It does nothing, if the writer is already closed or aborted, so it is safe to defer.
+func (w *AtomicWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+
+	w.done = true
+
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+// WriteFileAtomic is the same as os.WriteFile, but writes through AtomicWriter,
+// so the file is either fully replaced or left intact.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	w, err := NewAtomicWriter(path, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		_ = w.Abort()
+		return err
+	}
+
+	return w.Close()
+}
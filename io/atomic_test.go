@@ -0,0 +1,99 @@
+package io
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "config.json")
+
+	assert.Nil(t, WriteFileAtomic(name, []byte("{}"), 0600))
+	assertFileContent(t, name, "{}")
+
+	assert.Nil(t, WriteFileAtomic(name, []byte(`{"a":1}`), 0640))
+	assertFileContent(t, name, `{"a":1}`)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(name)
+		if assert.Nil(t, err) {
+			assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		}
+	}
+
+	assertDirNames(t, dir, "config.json")
+
+	assert.NotNil(t, WriteFileAtomic(filepath.Join(dir, "missing", "config.json"), nil, 0600))
+}
+
+func TestAtomicWriter_Abort(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "config.json")
+	writeTestFile(t, name, "old")
+
+	w, err := NewAtomicWriter(name, 0644)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	_, err = w.Write([]byte("new"))
+	assert.Nil(t, err)
+	assertDirNames(t, dir, filepath.Base(w.Name()), "config.json")
+
+	assert.Nil(t, w.Abort())
+	assert.Nil(t, w.Abort())
+	assert.ErrorIs(t, w.Close(), os.ErrClosed)
+
+	_, err = w.Write([]byte("new"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	assertFileContent(t, name, "old")
+	assertDirNames(t, dir, "config.json")
+}
+
+func TestAtomicWriter_CloseOr(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "config.json")
+
+	w, err := NewAtomicWriter(name, 0644)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	_, err = w.Write([]byte("new"))
+	assert.Nil(t, err)
+
+	var closeErr error
+	CloseOr(func(err error) {
+		closeErr = err
+	}, w)
+
+	assert.Nil(t, closeErr)
+	assert.Nil(t, w.Abort())
+	assertFileContent(t, name, "new")
+
+	assert.True(t, errors.Is(Close(w), os.ErrClosed))
+}
+
+func assertDirNames(t *testing.T, dir string, expected ...string) {
+	t.Helper()
+
+	infos, err := ioutil.ReadDir(dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+
+	assert.Equal(t, expected, names)
+}
@@ -0,0 +1,275 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	// Files with a zero byte among the first textProbeSize bytes are considered binary, the same way git does.
+	textProbeSize = 8000
+
+	DefaultMaxRanges = 1000
+)
+
+// ByteRange is a half-open range [Offset, Offset+Length) of file bytes.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+func (r ByteRange) End() int64 {
+	return r.Offset + r.Length
+}
+
+// FileComparison describes how contents of two files differ.
+type FileComparison struct {
+	Equal bool
+
+	// Offset of the first differing byte or -1, if files are equal.
+	// If one file is a prefix of the other, it is the size of the shorter one.
+	Offset int64
+
+	// One-based number of the line containing the first differing byte.
+	// Zero, if files are equal or binary.
+	Line int
+
+	// True, if any file has a zero byte at the beginning.
+	Binary bool
+
+	// Differing byte ranges in ascending order, filled only if requested.
+	// Trailing bytes of the longer file form the last range.
+	Ranges []ByteRange
+
+	// True, if there are more differing ranges than the options allow to collect.
+	RangesTruncated bool
+}
+
+type CompareFilesOptions struct {
+	// Set this to true to collect differing byte ranges, which requires reading files till the end.
+	Ranges bool
+
+	// Zero or less means DefaultMaxRanges.
+	MaxRanges int
+}
+
+// CompareFiles compares contents of two regular files and finds the first difference.
+func CompareFiles(path1, path2 string) (*FileComparison, error) {
+	return CompareFilesContext(context.Background(), path1, path2, CompareFilesOptions{})
+}
+
+func CompareFilesWithOptions(path1, path2 string, opts CompareFilesOptions) (*FileComparison, error) {
+	return CompareFilesContext(context.Background(), path1, path2, opts)
+}
+
+// CompareFilesContext is the same as CompareFilesWithOptions,
+// but stops and returns ctx.Err() as soon as the context is done.
+func CompareFilesContext(ctx context.Context, path1, path2 string, opts CompareFilesOptions) (*FileComparison, error) {
+	if _, err := checkFileOrDir("compare", path1, false); err != nil {
+		return nil, err
+	}
+
+	if _, err := checkFileOrDir("compare", path2, false); err != nil {
+		return nil, err
+	}
+
+	return compareFiles(ctx, path1, path2, &opts, true)
+}
+
+func compareFiles(ctx context.Context, path1, path2 string, opts *CompareFilesOptions, concurrent bool) (*FileComparison, error) {
+	file1, file2, err := openPair(osFiles, path1, osFiles, path2)
+	if err != nil {
+		return nil, err
+	}
+
+	return compareReadClosers(ctx, file1, file2, opts, concurrent)
+}
+
+// Same as compareReaders, but closes the readers.
+func compareReadClosers(
+	ctx context.Context,
+	file1, file2 io.ReadCloser,
+	opts *CompareFilesOptions,
+	concurrent bool,
+) (*FileComparison, error) {
+	result, err := compareReaders(ctx, file1, file2, opts, concurrent)
+	if err != nil {
+		closeQuietly(file1, file2)
+		return nil, err
+	}
+
+	if err := closeMany(file1, file2); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Same as readersContentEqual, but finds where the readers differ.
+func compareReaders(ctx context.Context, r1, r2 io.Reader, opts *CompareFilesOptions, concurrent bool) (*FileComparison, error) {
+	maxRanges := opts.MaxRanges
+	if maxRanges <= 0 {
+		maxRanges = DefaultMaxRanges
+	}
+
+	buf1 := make([]byte, bufferSize)
+	buf2 := make([]byte, bufferSize)
+
+	result := &FileComparison{Offset: -1, Line: 1}
+	var eof1, eof2 bool
+	var offset int64
+
+	var wg sync.WaitGroup
+
+	// Extends the last range, if it ends right at the offset, or appends a new one.
+	addRange := func(rangeOffset, length int64) {
+		if n := len(result.Ranges); n > 0 && result.Ranges[n-1].End() == rangeOffset {
+			result.Ranges[n-1].Length += length
+		} else if n < maxRanges {
+			result.Ranges = append(result.Ranges, ByteRange{Offset: rangeOffset, Length: length})
+		} else {
+			result.RangesTruncated = true
+		}
+	}
+
+	for first := true; !eof1 || !eof2; first = false {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var (
+			n1, n2     int
+			err1, err2 error
+		)
+
+		if concurrent {
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+				if !eof1 {
+					n1, err1 = readChunk(r1, buf1)
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+				if !eof2 {
+					n2, err2 = readChunk(r2, buf2)
+				}
+			}()
+
+			wg.Wait()
+		} else {
+			if !eof1 {
+				n1, err1 = readChunk(r1, buf1)
+			}
+			if !eof2 {
+				n2, err2 = readChunk(r2, buf2)
+			}
+		}
+
+		if err1 != nil && !errors.Is(err1, EOF) {
+			return nil, err1
+		}
+		eof1 = eof1 || err1 != nil
+
+		if err2 != nil && !errors.Is(err2, EOF) {
+			return nil, err2
+		}
+		eof2 = eof2 || err2 != nil
+
+		chunk1, chunk2 := buf1[:n1], buf2[:n2]
+
+		if first {
+			result.Binary = bytes.IndexByte(chunk1[:minInt(n1, textProbeSize)], 0) >= 0 ||
+				bytes.IndexByte(chunk2[:minInt(n2, textProbeSize)], 0) >= 0
+		}
+
+		common := minInt(n1, n2)
+
+		if result.Offset < 0 {
+			i := firstDifference(chunk1[:common], chunk2[:common])
+			if i < 0 && n1 != n2 {
+				i = common
+			}
+
+			if i >= 0 {
+				result.Offset = offset + int64(i)
+				result.Line += bytes.Count(chunk1[:i], []byte{'\n'})
+			} else {
+				result.Line += bytes.Count(chunk1, []byte{'\n'})
+			}
+		}
+
+		if result.Offset >= 0 && !opts.Ranges {
+			break
+		}
+
+		if opts.Ranges && result.Offset >= 0 {
+			for i := 0; i < common; {
+				if chunk1[i] == chunk2[i] {
+					i++
+					continue
+				}
+
+				j := i + 1
+				for j < common && chunk1[j] != chunk2[j] {
+					j++
+				}
+
+				addRange(offset+int64(i), int64(j-i))
+				i = j
+			}
+
+			if tail := maxInt(n1, n2) - common; tail > 0 {
+				addRange(offset+int64(common), int64(tail))
+			}
+		}
+
+		offset += int64(maxInt(n1, n2))
+	}
+
+	if result.Offset < 0 {
+		result.Equal = true
+		result.Line = 0
+	} else if result.Binary {
+		result.Line = 0
+	}
+
+	return result, nil
+}
+
+// Returns the index of the first differing byte of two slices of the same length or -1, if they are equal.
+func firstDifference(b1, b2 []byte) int {
+	if bytes.Equal(b1, b2) {
+		return -1
+	}
+
+	for i := range b1 {
+		if b1[i] != b2[i] {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
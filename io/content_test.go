@@ -0,0 +1,72 @@
+package io
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareFiles_Text(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1.txt"), "one\ntwo\nthree\nfour\n")
+	writeTestFile(t, filepath.Join(dir, "2.txt"), "one\ntwo\nthr33\nfour\nfive\n")
+
+	result, err := CompareFiles(filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt"))
+	if assert.Nil(t, err) {
+		assert.False(t, result.Equal)
+		assert.Equal(t, int64(11), result.Offset)
+		assert.Equal(t, 3, result.Line)
+		assert.False(t, result.Binary)
+		assert.Nil(t, result.Ranges)
+	}
+
+	result, err = CompareFilesWithOptions(filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt"), CompareFilesOptions{
+		Ranges: true,
+	})
+	if assert.Nil(t, err) {
+		assert.Equal(t, []ByteRange{{Offset: 11, Length: 2}, {Offset: 19, Length: 5}}, result.Ranges)
+		assert.False(t, result.RangesTruncated)
+	}
+
+	result, err = CompareFilesWithOptions(filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt"), CompareFilesOptions{
+		Ranges:    true,
+		MaxRanges: 1,
+	})
+	if assert.Nil(t, err) {
+		assert.Equal(t, []ByteRange{{Offset: 11, Length: 2}}, result.Ranges)
+		assert.True(t, result.RangesTruncated)
+	}
+}
+
+func TestCompareFiles_Equal(t *testing.T) {
+	result, err := CompareFiles(diffPath("a1/0.bin"), diffPath("a2/0.bin"))
+	if assert.Nil(t, err) {
+		assert.True(t, result.Equal)
+		assert.Equal(t, int64(-1), result.Offset)
+		assert.Zero(t, result.Line)
+	}
+}
+
+func TestDiffDirsWithOptionsC_Content(t *testing.T) {
+	diffs, err := DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{
+		Content: &CompareFilesOptions{},
+	})
+
+	if !assert.Nil(t, err) || !assert.Equal(t, 15, len(diffs)) {
+		t.FailNow()
+	}
+
+	for _, i := range []int{2, 10} {
+		diff := diffs[i]
+		if assert.NotNil(t, diff.Content, diff.Path) {
+			expected, err := CompareFiles(diff.Item1.FullPath, diff.Item2.FullPath)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, diff.Content)
+			assert.False(t, diff.Content.Equal)
+		}
+	}
+
+	assert.Nil(t, diffs[0].Content)
+	assert.Nil(t, diffs[12].Content)
+}
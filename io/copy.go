@@ -0,0 +1,423 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OverwritePolicy tells what to do with existing destination entries.
+type OverwritePolicy int
+
+const (
+	// OverwriteNever fails, if a destination entry exists. Existing directories are merged though.
+	OverwriteNever OverwritePolicy = iota
+	// OverwriteAlways replaces existing destination entries, including ones of another type.
+	// Existing directories are merged, if the source entry is a directory too.
+	OverwriteAlways
+	// OverwriteSkip keeps existing destination entries and continues.
+	OverwriteSkip
+)
+
+type CopyOptions struct {
+	// Default is OverwriteNever.
+	Overwrite OverwritePolicy
+
+	// Set this to true to give copied files 0644 and new directories 0755 permissions instead of source ones,
+	// like extracted entries get. The umask applies to new directories only.
+	// Setuid, setgid and sticky bits are dropped then.
+	NoPreserveMode bool
+
+	// Set this to true to keep current modification times of copied entries instead of source ones.
+	NoPreserveModTime bool
+
+	// Set this to true to copy entries symbolic links point to instead of the links themselves.
+	// Links are copied as is by default, so their targets may become dangling.
+	FollowSymlinks bool
+}
+
+func (opts *CopyOptions) copier(ctx context.Context) *treeCopier {
+	return &treeCopier{
+		ctx:             ctx,
+		overwrite:       opts.Overwrite,
+		followSymlinks:  opts.FollowSymlinks,
+		preserveMode:    !opts.NoPreserveMode,
+		preserveModTime: !opts.NoPreserveModTime,
+	}
+}
+
+// CopyFile copies the regular file to the destination path, which must not be an existing directory,
+// unless OverwriteAlways is used. The source is followed, if it is a symbolic link.
+func CopyFile(src, dst string, opts CopyOptions) error {
+	return CopyFileContext(context.Background(), src, dst, opts)
+}
+
+// CopyFileContext is the same as CopyFile, but stops and returns ctx.Err() as soon as the context is done.
+// A canceled copy leaves no partially written destination file.
+func CopyFileContext(ctx context.Context, src, dst string, opts CopyOptions) error {
+	info, err := checkFileOrDir("copy", src, false)
+	if err != nil {
+		return err
+	}
+
+	return opts.copier(ctx).copyEntry(src, dst, ".", info)
+}
+
+// CopyDir copies the directory tree to the destination path, whose parent must exist,
+// like "cp -R" does. Existing destination directories are merged with the source ones.
+func CopyDir(src, dst string, opts CopyOptions) error {
+	return CopyDirContext(context.Background(), src, dst, opts)
+}
+
+// CopyDirContext is the same as CopyDir, but stops and returns ctx.Err() as soon as the context is done.
+func CopyDirContext(ctx context.Context, src, dst string, opts CopyOptions) error {
+	info, err := checkFileOrDir("copy", src, true)
+	if err != nil {
+		return err
+	}
+
+	if within, err := isWithinDir(dst, src); err != nil {
+		return err
+	} else if within {
+		return fmt.Errorf("cannot copy a directory into itself: %s", dst)
+	}
+
+	return opts.copier(ctx).copyEntry(src, dst, ".", info)
+}
+
+// Replaced in tests to emulate renames across devices.
+var rename = os.Rename
+
+// Move renames the file or directory, like "mv" does.
+// If the destination is on another device, the source is copied and removed afterwards.
+//
+// Unlike copying, OverwriteAlways replaces the existing destination together with its subtree.
+// The destination is moved aside first, when it cannot be replaced by a rename, e.g. it is a non-empty directory,
+// and it is restored, if moving fails.
+// The FollowSymlinks option is used only when copying across devices.
+func Move(src, dst string, opts CopyOptions) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		switch opts.Overwrite {
+		case OverwriteAlways:
+			return replaceEntry(src, dst, info, opts)
+		case OverwriteSkip:
+			return nil
+		default:
+			return errExist("move", dst)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	copied, err := moveEntry(src, dst, info, opts)
+	if err != nil || !copied {
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+// Moves the source to the existing destination, which is left intact on failure.
+func replaceEntry(src, dst string, info os.FileInfo, opts CopyOptions) error {
+	// Files and empty directories are replaced atomically.
+	if err := rename(src, dst); err == nil {
+		return nil
+	}
+
+	tempDir, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".*.old")
+	if err != nil {
+		return err
+	}
+
+	aside := filepath.Join(tempDir, filepath.Base(dst))
+	if err := os.Rename(dst, aside); err != nil {
+		return appendError(err, os.Remove(tempDir))
+	}
+
+	copied, err := moveEntry(src, dst, info, opts)
+	if err != nil {
+		// A partial copy, if any, is replaced with the original destination.
+		if removeErr := os.RemoveAll(dst); removeErr != nil {
+			return appendError(err, removeErr)
+		}
+
+		if restoreErr := os.Rename(aside, dst); restoreErr != nil {
+			return appendError(err, restoreErr)
+		}
+
+		return appendError(err, os.Remove(tempDir))
+	}
+
+	if err := os.RemoveAll(tempDir); err != nil {
+		return err
+	}
+
+	if copied {
+		return os.RemoveAll(src)
+	}
+
+	return nil
+}
+
+// Renames the source or copies it across devices, in which case the source is left to be removed by the caller.
+func moveEntry(src, dst string, info os.FileInfo, opts CopyOptions) (copied bool, err error) {
+	if err := rename(src, dst); err == nil || !isCrossDevice(err) {
+		return false, err
+	}
+
+	if isSymlink(info) && opts.FollowSymlinks {
+		if info, err = os.Stat(src); err != nil {
+			return false, err
+		}
+	}
+
+	if err := opts.copier(context.Background()).copyEntry(src, dst, ".", info); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Returns true iff the path is the directory itself or any entry of its subtree.
+func isWithinDir(path, dir string) (bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		// Paths on different volumes.
+		return false, nil
+	}
+
+	return rel == "." || rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// treeCopier copies files, symbolic links and directory trees.
+type treeCopier struct {
+	ctx context.Context
+
+	overwrite OverwritePolicy
+
+	// Set this to true to copy entries symbolic links point to instead of the links themselves.
+	followSymlinks bool
+
+	preserveMode    bool
+	preserveModTime bool
+	preserveOwner   bool
+
+	// Optional filter of directory children, see CompareOptions.accepts.
+	accepts func(rel, name string, dir bool) bool
+
+	buf []byte
+}
+
+func (c *treeCopier) stat(path string) (os.FileInfo, error) {
+	if c.followSymlinks {
+		return os.Stat(path)
+	}
+
+	return os.Lstat(path)
+}
+
+// Copies the entry, described by info, handling an existing destination according to the overwrite policy.
+func (c *treeCopier) copyEntry(srcPath, dstPath, rel string, info os.FileInfo) error {
+	if dstInfo, err := os.Lstat(dstPath); err == nil {
+		if !isDir(info) || !isDir(dstInfo) {
+			switch c.overwrite {
+			case OverwriteAlways:
+				if dstInfo.Mode().Type() != info.Mode().Type() {
+					if err := os.RemoveAll(dstPath); err != nil {
+						return err
+					}
+				}
+			case OverwriteSkip:
+				return nil
+			default:
+				return errExist("copy", dstPath)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	switch {
+	case isDir(info):
+		return c.copyDir(srcPath, dstPath, rel, info)
+	case isFile(info):
+		return c.copyFile(srcPath, dstPath, info)
+	case isSymlink(info):
+		return c.copySymlink(srcPath, dstPath, info)
+	default:
+		return errUnsupportedPathType("copy", srcPath)
+	}
+}
+
+func (c *treeCopier) copyDir(srcPath, dstPath, rel string, info os.FileInfo) error {
+	// The directory must stay writable until its children are copied, so its mode is applied afterwards.
+	perm := os.FileMode(0755)
+	if c.preserveMode {
+		perm = info.Mode().Perm() | 0700
+	}
+
+	if err := os.Mkdir(dstPath, perm); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	infos, err := ioutil.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+
+	for _, itemInfo := range infos {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+
+		itemSrcPath := filepath.Join(srcPath, itemInfo.Name())
+		itemRel := relativePath(rel, itemInfo.Name())
+
+		if c.followSymlinks && isSymlink(itemInfo) {
+			if itemInfo, err = os.Stat(itemSrcPath); err != nil {
+				return err
+			}
+		}
+
+		if c.accepts != nil && !c.accepts(itemRel, itemInfo.Name(), isDir(itemInfo)) {
+			continue
+		}
+
+		if err := c.copyEntry(itemSrcPath, filepath.Join(dstPath, itemInfo.Name()), itemRel, itemInfo); err != nil {
+			return err
+		}
+	}
+
+	return c.applyMetadata(dstPath, info)
+}
+
+// Copies the file into a temporary one next to the destination and renames it,
+// so the destination is replaced even if it is read-only, and is never left half-written.
+func (c *treeCopier) copyFile(srcPath, dstPath string, info os.FileInfo) (err error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+
+	defer closeQuietly(src)
+
+	dst, err := ioutil.TempFile(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			closeQuietly(dst)
+			_ = os.Remove(dst.Name())
+		}
+	}()
+
+	if c.buf == nil {
+		c.buf = make([]byte, bufferSize)
+	}
+
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := readChunk(src, c.buf)
+		if _, err := dst.Write(c.buf[:n]); err != nil {
+			return err
+		}
+
+		if errors.Is(err, EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// Temporary files are created with 0600, so permissions are always set.
+	// Setuid, setgid and sticky bits are applied with the rest of the metadata.
+	perm := os.FileMode(0644)
+	if c.preserveMode {
+		perm = info.Mode().Perm()
+	}
+
+	if err := dst.Chmod(perm); err != nil {
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if err := c.applyMetadata(dst.Name(), info); err != nil {
+		return err
+	}
+
+	return os.Rename(dst.Name(), dstPath)
+}
+
+func (c *treeCopier) copySymlink(srcPath, dstPath string, info os.FileInfo) error {
+	target, err := os.Readlink(srcPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Symlink(target, dstPath); err != nil {
+		return err
+	}
+
+	return c.applyMetadata(dstPath, info)
+}
+
+// Applies the preserved metadata of info to the path.
+// Modes and times of symbolic links are left intact, because they cannot be changed portably.
+func (c *treeCopier) applyMetadata(path string, info os.FileInfo) error {
+	if c.preserveOwner {
+		if uid, gid, ok := fileOwner(info); ok {
+			if err := os.Lchown(path, int(uid), int(gid)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if isSymlink(info) {
+		return nil
+	}
+
+	if c.preserveMode {
+		if err := os.Chmod(path, info.Mode()&permissionBits); err != nil {
+			return err
+		}
+	}
+
+	if c.preserveModTime {
+		if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
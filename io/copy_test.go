@@ -0,0 +1,236 @@
+package io
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.txt"), filepath.Join(dir, "dst.txt")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	writeTestFile(t, src, "source")
+	assert.Nil(t, os.Chmod(src, 0640))
+	assert.Nil(t, os.Chtimes(src, modTime, modTime))
+
+	assert.Nil(t, CopyFile(src, dst, CopyOptions{}))
+	assertFileContent(t, dst, "source")
+
+	info, err := os.Stat(dst)
+	if assert.Nil(t, err) {
+		assert.True(t, modTime.Equal(info.ModTime()))
+		if runtime.GOOS != "windows" {
+			assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		}
+	}
+
+	writeTestFile(t, dst, "destination")
+
+	assert.NotNil(t, CopyFile(src, dst, CopyOptions{}))
+	assertFileContent(t, dst, "destination")
+
+	assert.Nil(t, CopyFile(src, dst, CopyOptions{Overwrite: OverwriteSkip}))
+	assertFileContent(t, dst, "destination")
+
+	assert.Nil(t, CopyFile(src, dst, CopyOptions{Overwrite: OverwriteAlways, NoPreserveModTime: true}))
+	assertFileContent(t, dst, "source")
+
+	info, err = os.Stat(dst)
+	if assert.Nil(t, err) {
+		assert.False(t, modTime.Equal(info.ModTime()))
+	}
+
+	assert.NotNil(t, CopyFile(dir, dst, CopyOptions{Overwrite: OverwriteAlways}))
+}
+
+func TestCopyDirC(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "c2")
+
+	assert.Nil(t, CopyDir(diffPath("c2"), dst, CopyOptions{}))
+
+	equal, err := DirsEqualWithOptions(diffPath("c2"), dst, CompareOptions{ComparePermissions: true, CompareModTime: true})
+	assert.Nil(t, err)
+	assert.True(t, equal)
+
+	// Directories are merged, but files are not overwritten.
+	assert.NotNil(t, CopyDir(diffPath("c1"), dst, CopyOptions{}))
+	assert.Nil(t, CopyDir(diffPath("c1"), dst, CopyOptions{Overwrite: OverwriteSkip}))
+
+	diffs, err := DiffDirs(diffPath("c2"), dst)
+	assert.Nil(t, err)
+	assert.Equal(t, DiffCounts{DiffKindAdded: 4}, CountDiffs(diffs))
+}
+
+func TestCopyDir_IntoItself(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+
+	assert.NotNil(t, CopyDir(dir, filepath.Join(dir, "copy"), CopyOptions{}))
+	assert.NotNil(t, CopyDir(dir, dir, CopyOptions{}))
+}
+
+func TestCopyDir_Symlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	assert.Nil(t, os.Symlink("a.txt", filepath.Join(src, "link")))
+
+	assert.Nil(t, CopyDir(src, filepath.Join(dir, "links"), CopyOptions{}))
+
+	target, err := os.Readlink(filepath.Join(dir, "links", "link"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a.txt", target)
+
+	assert.Nil(t, CopyDir(src, filepath.Join(dir, "files"), CopyOptions{FollowSymlinks: true}))
+
+	info, err := os.Lstat(filepath.Join(dir, "files", "link"))
+	if assert.Nil(t, err) {
+		assert.True(t, info.Mode().IsRegular())
+	}
+	assertFileContent(t, filepath.Join(dir, "files", "link"), "a")
+}
+
+func TestCopyDir_NoPreserveMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on Windows")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "sub", "a.txt"), "a")
+	assert.Nil(t, os.Chmod(filepath.Join(src, "sub", "a.txt"), 0600))
+	assert.Nil(t, os.Chmod(filepath.Join(src, "sub"), 0700))
+
+	dst := filepath.Join(dir, "dst")
+	if !assert.Nil(t, CopyDir(src, dst, CopyOptions{NoPreserveMode: true})) {
+		t.FailNow()
+	}
+
+	// Directory permissions are subject to umask.
+	defaultDir := filepath.Join(dir, "default")
+	assert.Nil(t, os.Mkdir(defaultDir, 0755))
+
+	expected, err := os.Stat(defaultDir)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "sub"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, expected.Mode(), info.Mode())
+	}
+
+	info, err = os.Stat(filepath.Join(dst, "sub", "a.txt"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0644), info.Mode())
+	}
+}
+
+func TestMove(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dst, "b.txt"), "b")
+
+	assert.NotNil(t, Move(src, dst, CopyOptions{}))
+
+	assert.Nil(t, Move(src, dst, CopyOptions{Overwrite: OverwriteAlways}))
+	assertFileContent(t, filepath.Join(dst, "a.txt"), "a")
+
+	exists, err := Exists(filepath.Join(dst, "b.txt"))
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	exists, err = Exists(src)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestMove_CrossDevice(t *testing.T) {
+	if errCrossDevice == nil {
+		t.Skip("renames across file systems are not detected on this system")
+	}
+
+	defer func(original func(oldpath, newpath string) error) {
+		rename = original
+	}(rename)
+
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errCrossDevice}
+	}
+
+	dst := filepath.Join(t.TempDir(), "c2")
+	src := filepath.Join(t.TempDir(), "c2")
+	assert.Nil(t, CopyDir(diffPath("c2"), src, CopyOptions{}))
+
+	assert.Nil(t, Move(src, dst, CopyOptions{}))
+
+	equal, err := DirsEqual(diffPath("c2"), dst)
+	assert.Nil(t, err)
+	assert.True(t, equal)
+
+	exists, err := Exists(src)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	// The existing destination is replaced.
+	assert.Nil(t, CopyDir(diffPath("c1"), src, CopyOptions{}))
+	assert.Nil(t, Move(src, dst, CopyOptions{Overwrite: OverwriteAlways}))
+
+	equal, err = DirsEqual(diffPath("c1"), dst)
+	assert.Nil(t, err)
+	assert.True(t, equal)
+
+	assertDirNames(t, filepath.Dir(dst), "c2")
+}
+
+func TestMove_OverwriteFailure(t *testing.T) {
+	defer func(original func(oldpath, newpath string) error) {
+		rename = original
+	}(rename)
+
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrPermission}
+	}
+
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dst, "b.txt"), "b")
+
+	assert.ErrorIs(t, Move(src, dst, CopyOptions{Overwrite: OverwriteAlways}), os.ErrPermission)
+
+	assertDirNames(t, dir, "dst", "src")
+	assertDirNames(t, dst, "b.txt")
+	assertDirNames(t, src, "a.txt")
+
+	// A file is replaced with a directory.
+	assert.Nil(t, os.RemoveAll(dst))
+	writeTestFile(t, dst, "b")
+
+	rename = os.Rename
+	assert.Nil(t, Move(src, dst, CopyOptions{Overwrite: OverwriteAlways}))
+
+	assertDirNames(t, dir, "dst")
+	assertFileContent(t, filepath.Join(dst, "a.txt"), "a")
+}
+
+func assertFileContent(t *testing.T, name, expected string) {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(name)
+	if assert.Nil(t, err) {
+		assert.Equal(t, expected, string(content))
+	}
+}
@@ -0,0 +1,366 @@
+package io
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DigestAlgorithm is a hash function used to compare files by digests instead of contents.
+type DigestAlgorithm int
+
+const (
+	// DigestNone means files are compared byte by byte.
+	DigestNone DigestAlgorithm = iota
+	// DigestSHA256 is a cryptographic hash, which is safe against crafted collisions.
+	DigestSHA256
+	// DigestFNV64a is a fast non-cryptographic hash, which is fine for trusted trees.
+	DigestFNV64a
+)
+
+var digestAlgorithmNames = map[DigestAlgorithm]string{
+	DigestNone:   "none",
+	DigestSHA256: "sha256",
+	DigestFNV64a: "fnv64a",
+}
+
+func (a DigestAlgorithm) String() string {
+	if name, ok := digestAlgorithmNames[a]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("DigestAlgorithm(%d)", int(a))
+}
+
+func (a DigestAlgorithm) MarshalText() ([]byte, error) {
+	if _, ok := digestAlgorithmNames[a]; !ok {
+		return nil, fmt.Errorf("unknown digest algorithm: %d", int(a))
+	}
+
+	return []byte(a.String()), nil
+}
+
+func (a *DigestAlgorithm) UnmarshalText(text []byte) error {
+	for algorithm, name := range digestAlgorithmNames {
+		if name == string(text) {
+			*a = algorithm
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown digest algorithm: %s", text)
+}
+
+func (a DigestAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestFNV64a:
+		return fnv.New64a(), nil
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm: %v", a)
+	}
+}
+
+// DigestKey identifies a file version, i.e. the digest is considered outdated, if the file size or mtime change.
+type DigestKey struct {
+	// Absolute path of the file.
+	Path      string
+	Size      int64
+	ModTime   time.Time
+	Algorithm DigestAlgorithm
+}
+
+// DigestCache stores file digests between comparisons.
+// Implementations must be safe for concurrent use, because files may be compared by several workers.
+type DigestCache interface {
+	Get(key DigestKey) (digest []byte, ok bool)
+	Put(key DigestKey, digest []byte)
+}
+
+type digestEntryKey struct {
+	path      string
+	algorithm DigestAlgorithm
+}
+
+type digestEntry struct {
+	size    int64
+	modTime time.Time
+	digest  []byte
+}
+
+var _ DigestCache = (*MemoryDigestCache)(nil)
+
+// MemoryDigestCache keeps the latest digest of every file in memory.
+// The zero value is an empty cache ready to use.
+type MemoryDigestCache struct {
+	mu      sync.Mutex
+	entries map[digestEntryKey]digestEntry
+}
+
+func NewMemoryDigestCache() *MemoryDigestCache {
+	return &MemoryDigestCache{}
+}
+
+func (c *MemoryDigestCache) Get(key DigestKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[digestEntryKey{path: key.Path, algorithm: key.Algorithm}]
+	if !ok || entry.size != key.Size || !entry.modTime.Equal(key.ModTime) {
+		return nil, false
+	}
+
+	return entry.digest, true
+}
+
+func (c *MemoryDigestCache) Put(key DigestKey, digest []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[digestEntryKey]digestEntry)
+	}
+
+	c.entries[digestEntryKey{path: key.Path, algorithm: key.Algorithm}] = digestEntry{
+		size:    key.Size,
+		modTime: key.ModTime,
+		digest:  digest,
+	}
+}
+
+// Len returns the number of cached digests.
+func (c *MemoryDigestCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+var _ DigestCache = (*FileDigestCache)(nil)
+
+// FileDigestCache is a MemoryDigestCache, which is loaded from and saved to a file
+// to speed up comparisons across process runs.
+// The file contains one JSON object per line.
+type FileDigestCache struct {
+	MemoryDigestCache
+	path string
+}
+
+type fileDigestCacheLine struct {
+	Path      string          `json:"path"`
+	Size      int64           `json:"size"`
+	ModTime   time.Time       `json:"mtime"`
+	Algorithm DigestAlgorithm `json:"algorithm"`
+	Digest    string          `json:"digest"`
+}
+
+// OpenFileDigestCache loads the cache from the file, which may not exist yet.
+// Call Save or Close to write the cache back.
+func OpenFileDigestCache(path string) (*FileDigestCache, error) {
+	if len(path) <= 0 {
+		return nil, ErrEmptyPath
+	}
+
+	c := &FileDigestCache{path: path}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer closeQuietly(file)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, bufferSize)
+
+	for scanner.Scan() {
+		var line fileDigestCacheLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("invalid digest cache %s: %w", path, err)
+		}
+
+		digest, err := hex.DecodeString(line.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest cache %s: %w", path, err)
+		}
+
+		c.Put(DigestKey{Path: line.Path, Size: line.Size, ModTime: line.ModTime, Algorithm: line.Algorithm}, digest)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Save writes the cache with AtomicWriter, so a crash never leaves the cache file half-written.
+// Entries are sorted by paths and algorithms, so the same cache is always saved the same way.
+func (c *FileDigestCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file, err := NewAtomicWriter(c.path, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Abort()
+	}()
+
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+
+	keys := make([]digestEntryKey, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+
+		return keys[i].algorithm < keys[j].algorithm
+	})
+
+	for _, key := range keys {
+		entry := c.entries[key]
+
+		if err := encoder.Encode(fileDigestCacheLine{
+			Path:      key.path,
+			Size:      entry.size,
+			ModTime:   entry.modTime,
+			Algorithm: key.algorithm,
+			Digest:    hex.EncodeToString(entry.digest),
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// Close is the same as Save, so the cache can be closed with Close and similar functions.
+func (c *FileDigestCache) Close() error {
+	return c.Save()
+}
+
+// FileDigest computes the digest of the regular file.
+func FileDigest(path string, algorithm DigestAlgorithm) ([]byte, error) {
+	info, err := checkFileOrDir("digest", path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileDigest(context.Background(), path, info, algorithm, nil)
+}
+
+// Computes the digest of the file or takes it from the cache, which may be nil.
+func fileDigest(ctx context.Context, path string, info os.FileInfo, algorithm DigestAlgorithm, cache DigestCache) ([]byte, error) {
+	var key DigestKey
+
+	if cache != nil {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		key = DigestKey{Path: abs, Size: info.Size(), ModTime: info.ModTime(), Algorithm: algorithm}
+
+		if digest, ok := cache.Get(key); ok {
+			return digest, nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := readCloserDigest(ctx, file, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		cache.Put(key, digest)
+	}
+
+	return digest, nil
+}
+
+// Same as fileDigest, but reads the file in its tree. Digests of files outside of the OS file system are not cached,
+// because they have no absolute paths.
+func fileInfoDigest(ctx context.Context, info *FileInfo, algorithm DigestAlgorithm, cache DigestCache) ([]byte, error) {
+	if info.tree == nil {
+		return fileDigest(ctx, info.FullPath, info, algorithm, cache)
+	}
+
+	file, err := info.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return readCloserDigest(ctx, file, algorithm)
+}
+
+// Computes the digest of the reader and closes it.
+func readCloserDigest(ctx context.Context, r io.ReadCloser, algorithm DigestAlgorithm) ([]byte, error) {
+	h, err := algorithm.newHash()
+	if err != nil {
+		closeQuietly(r)
+		return nil, err
+	}
+
+	if err := readerDigest(ctx, r, h); err != nil {
+		closeQuietly(r)
+		return nil, err
+	}
+
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// Writes the reader into the hash, checking the context between chunks.
+func readerDigest(ctx context.Context, r io.Reader, h hash.Hash) error {
+	buf := make([]byte, bufferSize)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := readChunk(r, buf)
+		h.Write(buf[:n])
+
+		if errors.Is(err, EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package io
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileDigest_Empty(t *testing.T) {
+	digest, err := FileDigest(diffPath("a1/empty.txt"), DigestSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", hex.EncodeToString(digest))
+
+	digest, err = FileDigest(diffPath("a1/empty.txt"), DigestFNV64a)
+	assert.Nil(t, err)
+	assert.Equal(t, "cbf29ce484222325", hex.EncodeToString(digest))
+}
+
+func TestDiffDirsWithOptionsC_Digest(t *testing.T) {
+	expected, err := DiffDirs(diffPath("c1"), diffPath("c2"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	cache := NewMemoryDigestCache()
+
+	for i := 0; i < 2; i++ {
+		diffs, err := DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{
+			Digest:      DigestFNV64a,
+			DigestCache: cache,
+			Workers:     i * 4,
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, diffs)
+	}
+
+	// Files of different sizes are never hashed.
+	assert.Equal(t, 6, cache.Len())
+}
+
+func TestFileDigestCache_SaveAndOpen(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "digests.jsonl")
+
+	cache, err := OpenFileDigestCache(cachePath)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	equal, err := DirsEqualWithOptions(diffPath("a1"), diffPath("a2"), CompareOptions{
+		Digest:      DigestSHA256,
+		DigestCache: cache,
+	})
+	assert.Nil(t, err)
+	assert.True(t, equal)
+	assert.Equal(t, 6, cache.Len())
+	assert.Nil(t, cache.Close())
+
+	// Saving is deterministic.
+	saved, err := ioutil.ReadFile(cachePath)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, cache.Save())
+
+		resaved, err := ioutil.ReadFile(cachePath)
+		assert.Nil(t, err)
+		assert.Equal(t, string(saved), string(resaved))
+	}
+
+	cache, err = OpenFileDigestCache(cachePath)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 6, cache.Len())
+
+		abs, err := filepath.Abs(diffPath("a1/1.bin"))
+		assert.Nil(t, err)
+		info, err := checkFileOrDir("digest", abs, false)
+		assert.Nil(t, err)
+
+		expected, err := FileDigest(abs, DigestSHA256)
+		assert.Nil(t, err)
+
+		digest, ok := cache.Get(DigestKey{Path: abs, Size: info.Size(), ModTime: info.ModTime(), Algorithm: DigestSHA256})
+		assert.True(t, ok)
+		assert.Equal(t, expected, digest)
+	}
+}
+
+func TestDirsEqualWithOptions_UnknownDigest(t *testing.T) {
+	_, err := DirsEqualWithOptions(diffPath("a1"), diffPath("a2"), CompareOptions{Digest: DigestAlgorithm(42)})
+	assert.NotNil(t, err)
+}
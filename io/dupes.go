@@ -0,0 +1,325 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Files of the same size are first compared by hashes of their beginnings, which is enough to tell most apart.
+const partialHashSize = 4 << 10
+
+type DuplicatesOptions struct {
+	// Filters of searched files, the same as for directory comparison.
+	// Only Include, Exclude, IncludeRegexps, ExcludeRegexps, MaxDepth, NoFollowSymlinks and Hidden are used.
+	Filter CompareOptions
+
+	// Files smaller than this are ignored. Empty files are never reported.
+	MinSize int64
+}
+
+// DuplicateGroup is a set of regular files with identical contents.
+type DuplicateGroup struct {
+	Size int64
+
+	// Files in the order they were found, i.e. in the order of roots and then names.
+	// Hard links to the same file are listed once.
+	Files []*FileInfo
+}
+
+// FindDuplicates finds regular files with identical contents in the directory trees.
+// See FindDuplicatesContext for details.
+func FindDuplicates(roots ...string) ([]DuplicateGroup, error) {
+	return FindDuplicatesContext(context.Background(), roots, DuplicatesOptions{})
+}
+
+// FindDuplicatesContext finds regular files with identical contents in the directory trees.
+// Files are grouped by sizes first, then by hashes of their beginnings and finally by SHA-256 digests,
+// so files are read only if there are other files of the same size, and at most twice:
+// their beginnings and their whole contents.
+// Groups are returned in the order of their first files.
+func FindDuplicatesContext(ctx context.Context, roots []string, opts DuplicatesOptions) ([]DuplicateGroup, error) {
+	if err := opts.Filter.validate(); err != nil {
+		return nil, err
+	}
+
+	minSize := opts.MinSize
+	if minSize < 1 {
+		minSize = 1
+	}
+
+	var sizes []int64
+	bySize := make(map[int64][]*FileInfo)
+
+	// Positions of files in the order they are found.
+	positions := make(map[*FileInfo]int)
+
+	// Hard links and files found through several roots or followed links are the same files.
+	seenInodes := make(map[inodeKey]bool)
+	seenPaths := make(map[string]bool)
+
+	for _, root := range roots {
+		rootInfo, err := checkFileOrDir("duplicates", root, true)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := walkTree(ctx, &opts.Filter, root, rootInfo, func(path, rel string, info os.FileInfo) error {
+			if !isFile(info) || info.Size() < minSize {
+				return nil
+			}
+
+			if dev, ino, _, ok := fileInode(info); ok {
+				key := inodeKey{dev: dev, ino: ino}
+				if seenInodes[key] {
+					return nil
+				}
+
+				seenInodes[key] = true
+			} else {
+				abs, err := filepath.Abs(path)
+				if err != nil {
+					return err
+				}
+
+				if seenPaths[abs] {
+					return nil
+				}
+
+				seenPaths[abs] = true
+			}
+
+			if _, ok := bySize[info.Size()]; !ok {
+				sizes = append(sizes, info.Size())
+			}
+
+			file := &FileInfo{FileInfo: info, FullPath: path}
+			positions[file] = len(positions)
+			bySize[info.Size()] = append(bySize[info.Size()], file)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var groups []DuplicateGroup
+
+	for _, size := range sizes {
+		files := bySize[size]
+		if len(files) < 2 {
+			continue
+		}
+
+		sizeGroups, err := findSameSizeDuplicates(ctx, files)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, sizeGroups...)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return positions[groups[i].Files[0]] < positions[groups[j].Files[0]]
+	})
+
+	return groups, nil
+}
+
+func findSameSizeDuplicates(ctx context.Context, files []*FileInfo) ([]DuplicateGroup, error) {
+	var hashes []uint64
+	byHash := make(map[uint64][]*FileInfo)
+
+	for _, file := range files {
+		hash, err := partialHash(ctx, file.FullPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := byHash[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+
+		byHash[hash] = append(byHash[hash], file)
+	}
+
+	var groups []DuplicateGroup
+
+	for _, hash := range hashes {
+		candidates := byHash[hash]
+		if len(candidates) < 2 {
+			continue
+		}
+
+		var digests []string
+		byDigest := make(map[string][]*FileInfo)
+
+		for _, file := range candidates {
+			digest, err := fileDigest(ctx, file.FullPath, file, DigestSHA256, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := byDigest[string(digest)]; !ok {
+				digests = append(digests, string(digest))
+			}
+
+			byDigest[string(digest)] = append(byDigest[string(digest)], file)
+		}
+
+		// SHA-256 collisions are not expected, so files with the same digest are not compared byte by byte,
+		// which would read every file twice.
+		for _, digest := range digests {
+			if class := byDigest[digest]; len(class) > 1 {
+				groups = append(groups, DuplicateGroup{Size: class[0].Size(), Files: class})
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+func partialHash(ctx context.Context, path string) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+
+	h := fnv.New64a()
+	buf := make([]byte, partialHashSize)
+
+	n, err := readChunk(file, buf)
+	if err != nil && !errors.Is(err, EOF) {
+		closeQuietly(file)
+		return 0, err
+	}
+
+	h.Write(buf[:n])
+
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+
+	return h.Sum64(), nil
+}
+
+// LinkKind tells how ReplaceDuplicates replaces duplicates.
+type LinkKind int
+
+const (
+	// HardLink replaces duplicates with hard links, which requires files to be on the same device.
+	HardLink LinkKind = iota
+	// Symlink replaces duplicates with symbolic links to absolute paths of kept files.
+	Symlink
+)
+
+type ReplaceDuplicatesOptions struct {
+	// Default is HardLink.
+	Link LinkKind
+
+	// Set this to true to only plan replacements without changing anything.
+	DryRun bool
+}
+
+// DuplicateReplacement is a duplicate replaced with a link to the kept file.
+type DuplicateReplacement struct {
+	Path   string
+	Target string
+}
+
+// ReplaceDuplicates keeps the first file of every group and replaces the other ones with links to it.
+// Every link is created under a temporary name and renamed over the duplicate, so no file is ever missing.
+// A file, whose size or modification time has changed since it was found, results in an error.
+// The performed replacements are returned, even if an error occurs.
+func ReplaceDuplicates(groups []DuplicateGroup, opts ReplaceDuplicatesOptions) ([]DuplicateReplacement, error) {
+	var replacements []DuplicateReplacement
+
+	for _, group := range groups {
+		if len(group.Files) < 2 {
+			continue
+		}
+
+		kept := group.Files[0]
+
+		target, err := filepath.Abs(kept.FullPath)
+		if err != nil {
+			return replacements, err
+		}
+
+		if err := checkUnchanged(kept); err != nil {
+			return replacements, err
+		}
+
+		for _, duplicate := range group.Files[1:] {
+			if err := checkUnchanged(duplicate); err != nil {
+				return replacements, err
+			}
+
+			if !opts.DryRun {
+				if err := replaceWithLink(duplicate.FullPath, target, opts.Link); err != nil {
+					return replacements, err
+				}
+			}
+
+			replacements = append(replacements, DuplicateReplacement{Path: duplicate.FullPath, Target: target})
+		}
+	}
+
+	return replacements, nil
+}
+
+func checkUnchanged(file *FileInfo) error {
+	info, err := os.Stat(file.FullPath)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != file.Size() || !info.ModTime().Equal(file.ModTime()) {
+		return fmt.Errorf("file has changed since duplicates were found: %s", file.FullPath)
+	}
+
+	return nil
+}
+
+func replaceWithLink(path, target string, link LinkKind) error {
+	// Reserve a unique name next to the duplicate, so the link can be renamed over it.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmp.Name()
+	closeQuietly(tmp)
+
+	if err := os.Remove(tmpPath); err != nil {
+		return err
+	}
+
+	switch link {
+	case HardLink:
+		err = os.Link(target, tmpPath)
+	case Symlink:
+		err = os.Symlink(target, tmpPath)
+	default:
+		err = fmt.Errorf("unknown link kind: %d", int(link))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package io
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	prefix := strings.Repeat("x", partialHashSize)
+
+	writeTestFile(t, filepath.Join(dir1, "a.txt"), "same")
+	writeTestFile(t, filepath.Join(dir1, "b.txt"), "diff")
+	writeTestFile(t, filepath.Join(dir1, "empty1.txt"), "")
+	writeTestFile(t, filepath.Join(dir1, "empty2.txt"), "")
+	writeTestFile(t, filepath.Join(dir1, "long1.bin"), prefix+"1")
+	writeTestFile(t, filepath.Join(dir1, "long2.bin"), prefix+"2")
+	writeTestFile(t, filepath.Join(dir1, "sub", "long3.bin"), prefix+"1")
+	writeTestFile(t, filepath.Join(dir2, "a.txt"), "same")
+	writeTestFile(t, filepath.Join(dir2, "long4.bin"), prefix+"2")
+
+	groups, err := FindDuplicates(dir1, dir2)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, [][]string{
+		{filepath.Join(dir1, "a.txt"), filepath.Join(dir2, "a.txt")},
+		{filepath.Join(dir1, "long1.bin"), filepath.Join(dir1, "sub", "long3.bin")},
+		{filepath.Join(dir1, "long2.bin"), filepath.Join(dir2, "long4.bin")},
+	}, duplicatePaths(groups))
+	assert.Equal(t, int64(4), groups[0].Size)
+
+	// The same tree passed twice is searched once.
+	groups, err = FindDuplicatesContext(context.Background(), []string{dir1, dir1}, DuplicatesOptions{
+		Filter:  CompareOptions{Exclude: []string{"sub"}},
+		MinSize: 5,
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, groups)
+}
+
+func TestReplaceDuplicates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("links require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "same")
+	writeTestFile(t, filepath.Join(dir, "b.txt"), "same")
+	writeTestFile(t, filepath.Join(dir, "c.txt"), "same")
+
+	groups, err := FindDuplicates(dir)
+	if !assert.Nil(t, err) || !assert.Equal(t, 1, len(groups)) {
+		t.FailNow()
+	}
+
+	replacements, err := ReplaceDuplicates(groups, ReplaceDuplicatesOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []DuplicateReplacement{
+		{Path: filepath.Join(dir, "b.txt"), Target: filepath.Join(dir, "a.txt")},
+		{Path: filepath.Join(dir, "c.txt"), Target: filepath.Join(dir, "a.txt")},
+	}, replacements)
+
+	stats, err := DirStats(dir, DirStatsOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, 0, stats.HardLinks)
+	}
+
+	groups[0].Files = groups[0].Files[:2]
+	_, err = ReplaceDuplicates(groups, ReplaceDuplicatesOptions{})
+	assert.Nil(t, err)
+
+	stats, err = DirStats(dir, DirStatsOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, 1, stats.HardLinks)
+		assert.Equal(t, int64(8), stats.Size)
+	}
+
+	groups, err = FindDuplicates(dir)
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(groups)) {
+		assert.Equal(t, 2, len(groups[0].Files))
+		_, err = ReplaceDuplicates(groups, ReplaceDuplicatesOptions{Link: Symlink})
+		assert.Nil(t, err)
+	}
+
+	isSymlink, err := IsSymlink(filepath.Join(dir, "c.txt"))
+	assert.Nil(t, err)
+	assert.True(t, isSymlink)
+	assertFileContent(t, filepath.Join(dir, "c.txt"), "same")
+	assertDirNames(t, dir, "a.txt", "b.txt", "c.txt")
+
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "changed")
+	_, err = ReplaceDuplicates(groups, ReplaceDuplicatesOptions{})
+	assert.NotNil(t, err)
+}
+
+func duplicatePaths(groups []DuplicateGroup) [][]string {
+	paths := make([][]string, len(groups))
+
+	for i, group := range groups {
+		for _, file := range group.Files {
+			paths[i] = append(paths[i], file.FullPath)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,142 @@
+package io
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+var (
+	// ErrEmptyPath is returned as is, when an empty path is passed, because there is no path to report.
+	ErrEmptyPath = errors.New("path is empty")
+
+	// ErrNotFile means a regular file is expected.
+	ErrNotFile = errors.New("not a file")
+
+	// ErrNotDir means a directory is expected.
+	ErrNotDir = errors.New("not a directory")
+
+	// ErrUnsupported means the operation is not supported on this OS/ARCH.
+	ErrUnsupported = errors.New("operation is not supported on this OS/ARCH")
+
+	// ErrUnsupportedPathType means the operation does not support the type of the path entry,
+	// e.g. devices cannot be copied.
+	ErrUnsupportedPathType = errors.New("unsupported path type")
+
+	// ErrSymlinkLoop means a chain of symbolic links is cyclic or too long to resolve.
+	ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+
+	// ErrNotJunction means the path is not a junction or a link created by Junction.
+	ErrNotJunction = errors.New("not a junction")
+
+	// ErrUnknownArchiveFormat means the file is neither a tar, a gzip-compressed tar nor a zip archive.
+	ErrUnknownArchiveFormat = errors.New("unknown archive format")
+
+	// ErrUnsafeArchivePath means an archive entry name or link target points outside of the archive root,
+	// e.g. "../x".
+	ErrUnsafeArchivePath = errors.New("unsafe archive path")
+
+	// ErrArchiveLimit means an archive exceeds the size or the entry count limit of extraction.
+	ErrArchiveLimit = errors.New("archive exceeds extraction limits")
+
+	errNoParent = errors.New("path has no parent")
+)
+
+// PathError records an error together with the operation and the path, which caused it.
+// It is the same type as os.PathError, so errors of this package and os ones are matched alike.
+type PathError = fs.PathError
+
+// MultiError combines several errors, e.g. ones returned by CloseAll.
+// errors.Is and errors.As report a match, if any of the errors matches.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	}
+
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d errors: %s", len(e), strings.Join(messages, "; "))
+}
+
+func (e MultiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e MultiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Appends the error to the combined one, flattening multi-errors. Nil errors are ignored.
+func appendError(combined, err error) error {
+	if err == nil {
+		return combined
+	}
+
+	if combined == nil {
+		return err
+	}
+
+	var multi MultiError
+
+	if m, ok := combined.(MultiError); ok {
+		multi = append(multi, m...)
+	} else {
+		multi = append(multi, combined)
+	}
+
+	if m, ok := err.(MultiError); ok {
+		multi = append(multi, m...)
+	} else {
+		multi = append(multi, err)
+	}
+
+	return multi
+}
+
+// CloseError is an error returned by a single closer.
+type CloseError struct {
+	// Position of the closer among the ones passed to CloseAll or CloseInto.
+	Index int
+
+	Closer io.Closer
+	Err    error
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("close #%d %s: %v", e.Index, describeCloser(e.Closer), e.Err)
+}
+
+func (e *CloseError) Unwrap() error {
+	return e.Err
+}
+
+// Describes the closer by its name, like *os.File has, or by its type.
+func describeCloser(closer io.Closer) string {
+	if named, ok := closer.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+
+	return fmt.Sprintf("%T", closer)
+}
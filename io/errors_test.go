@@ -0,0 +1,114 @@
+package io
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCloser struct {
+	err error
+}
+
+func (c testCloser) Close() error {
+	return c.err
+}
+
+func TestCloseAll(t *testing.T) {
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+
+	assert.Nil(t, CloseAll())
+	assert.Nil(t, CloseAll(testCloser{}, nil, testCloser{}))
+
+	err := CloseAll(testCloser{err: errFirst}, testCloser{}, testCloser{err: errSecond})
+	assert.ErrorIs(t, err, errFirst)
+	assert.ErrorIs(t, err, errSecond)
+	assert.Equal(t, "2 errors: close #0 io.testCloser: first; close #2 io.testCloser: second", err.Error())
+
+	var closeErr *CloseError
+	if assert.True(t, errors.As(err, &closeErr)) {
+		assert.Equal(t, 0, closeErr.Index)
+		assert.Equal(t, errFirst, closeErr.Err)
+	}
+
+	assert.Equal(t, errFirst, Close(testCloser{err: errFirst}, testCloser{err: errSecond}))
+}
+
+func TestCloseAll_File(t *testing.T) {
+	file, err := os.Open(diffPath("a1/0.bin"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	assert.Nil(t, CloseAll(file))
+
+	err = CloseAll(file)
+	assert.ErrorIs(t, err, os.ErrClosed)
+	assert.Contains(t, err.Error(), "close #0 "+diffPath("a1/0.bin"))
+
+	var pathErr *os.PathError
+	assert.True(t, errors.As(err, &pathErr))
+}
+
+func TestCloseInto(t *testing.T) {
+	errResult, errClose := errors.New("result"), errors.New("close")
+
+	closeInto := func(result error, closers ...testCloser) (err error) {
+		defer func() {
+			for _, closer := range closers {
+				CloseInto(&err, closer)
+			}
+		}()
+
+		return result
+	}
+
+	assert.Nil(t, closeInto(nil, testCloser{}))
+	assert.Equal(t, errResult, closeInto(errResult, testCloser{}))
+
+	err := closeInto(nil, testCloser{err: errClose})
+	assert.ErrorIs(t, err, errClose)
+
+	err = closeInto(errResult, testCloser{err: errClose}, testCloser{err: errClose})
+	if assert.IsType(t, MultiError{}, err) {
+		assert.Equal(t, 3, len(err.(MultiError)))
+		assert.Equal(t, errResult, err.(MultiError)[0])
+	}
+	assert.ErrorIs(t, err, errResult)
+	assert.ErrorIs(t, err, errClose)
+}
+
+func TestSentinelErrors(t *testing.T) {
+	_, err := Exists("")
+	assert.Equal(t, ErrEmptyPath, err)
+
+	_, err = IsEmpty("")
+	assert.Equal(t, ErrEmptyPath, err)
+
+	_, err = Parent(string(os.PathSeparator))
+	var pathErr *PathError
+	if assert.True(t, errors.As(err, &pathErr)) {
+		assert.Equal(t, "parent", pathErr.Op)
+	}
+
+	_, err = DirsEqual(diffPath("a1/0.bin"), diffPath("a2"))
+	assert.ErrorIs(t, err, ErrNotDir)
+	if assert.True(t, errors.As(err, &pathErr)) {
+		assert.Equal(t, "compare", pathErr.Op)
+		assert.Equal(t, diffPath("a1/0.bin"), pathErr.Path)
+	}
+
+	_, err = CompareFiles(diffPath("a1"), diffPath("a2/0.bin"))
+	assert.ErrorIs(t, err, ErrNotFile)
+
+	err = Junction(diffPath("a1/0.bin"), diffPath("a1/junction"))
+	assert.ErrorIs(t, err, ErrNotDir)
+
+	err = Junction(diffPath("a1"), diffPath("a2"))
+	assert.True(t, os.IsExist(err))
+	if assert.True(t, errors.As(err, &pathErr)) {
+		assert.Equal(t, diffPath("a2"), pathErr.Path)
+	}
+}
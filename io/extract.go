@@ -0,0 +1,593 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultMaxExtractSize    = 1 << 30
+	DefaultMaxExtractEntries = 100000
+)
+
+type ExtractOptions struct {
+	// Default is ArchiveUnknown, which means detecting the format by contents.
+	Format ArchiveFormat
+
+	// Default is OverwriteNever. Existing directories are merged with archive ones in any case.
+	Overwrite OverwritePolicy
+
+	// Maximum total size of extracted files, which protects from decompression bombs.
+	// Use a negative value to extract files of any size.
+	// Zero means DefaultMaxExtractSize.
+	MaxSize int64
+
+	// Maximum number of archive entries.
+	// Use a negative value to extract any number of entries.
+	// Zero means DefaultMaxExtractEntries.
+	MaxEntries int
+
+	// Set this to true to keep default permissions of extracted entries instead of archive ones.
+	// Setuid, setgid and sticky bits are never extracted.
+	NoPreserveMode bool
+
+	// Set this to true to keep current modification times of extracted entries instead of archive ones.
+	NoPreserveModTime bool
+}
+
+// ExtractArchive extracts the tar, gzip-compressed tar or zip archive into the directory.
+// See ExtractArchiveContext for details.
+func ExtractArchive(src, dstDir string, opts ExtractOptions) error {
+	return ExtractArchiveContext(context.Background(), src, dstDir, opts)
+}
+
+// ExtractArchiveContext extracts the tar, gzip-compressed tar or zip archive into the directory,
+// which is created, if it does not exist. The archive is read sequentially without temporary files.
+//
+// Extraction never writes outside the directory, so ErrUnsafeArchivePath is returned for entries,
+// whose names refer to parent directories, for symbolic links, whose targets are absolute or outside the directory,
+// and for entries inside symbolic links. Hard links must refer to files extracted before.
+// ErrArchiveLimit is returned as soon as opts.MaxSize or opts.MaxEntries is exceeded.
+// Entries other than regular files, directories and links result in ErrUnsupportedPathType.
+//
+// An archive, which fails to extract or whose extraction is canceled, may be extracted partially,
+// but never with partially written files.
+func ExtractArchiveContext(ctx context.Context, src, dstDir string, opts ExtractOptions) (err error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer CloseInto(&err, file)
+
+	format := opts.Format
+	if format == ArchiveUnknown {
+		if format, err = detectArchiveFormat(file); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+
+	e := &extractor{
+		ctx:        ctx,
+		src:        src,
+		root:       dstDir,
+		overwrite:  opts.Overwrite,
+		maxSize:    opts.MaxSize,
+		maxEntries: opts.MaxEntries,
+		mode:       !opts.NoPreserveMode,
+		modTime:    !opts.NoPreserveModTime,
+		dirs:       make(map[string]extractedDir),
+	}
+
+	if e.maxSize == 0 {
+		e.maxSize = DefaultMaxExtractSize
+	}
+
+	if e.maxEntries == 0 {
+		e.maxEntries = DefaultMaxExtractEntries
+	}
+
+	switch format {
+	case ArchiveTar:
+		err = e.extractTar(file)
+	case ArchiveTarGzip:
+		err = e.extractTarGzip(file)
+	case ArchiveZip:
+		err = e.extractZip(file)
+	default:
+		return &PathError{Op: "extract", Path: src, Err: ErrUnknownArchiveFormat}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.applyDirsMetadata()
+}
+
+// extractor extracts entries of an archive one by one.
+type extractor struct {
+	ctx  context.Context
+	src  string
+	root string
+
+	overwrite  OverwritePolicy
+	maxSize    int64
+	maxEntries int
+	mode       bool
+	modTime    bool
+
+	size    int64
+	entries int
+
+	// Metadata of extracted directories, which is applied in the end, because extracting children changes it.
+	dirs map[string]extractedDir
+}
+
+type extractedDir struct {
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// archiveHeader describes an entry independently of the archive format.
+type archiveHeader struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+	size    int64
+
+	// Target of a symbolic link or of a tar hard link.
+	link     string
+	hardLink bool
+}
+
+func (e *extractor) extractTarGzip(file *os.File) error {
+	r, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+
+	if err := e.extractTar(r); err != nil {
+		return err
+	}
+
+	return r.Close()
+}
+
+func (e *extractor) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+
+	for {
+		tarHeader, err := tr.Next()
+		if err == EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if tarHeader.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		header := archiveHeader{
+			name:    tarHeader.Name,
+			mode:    tarHeader.FileInfo().Mode(),
+			modTime: tarHeader.ModTime,
+			size:    tarHeader.Size,
+			link:    tarHeader.Linkname,
+		}
+
+		switch tarHeader.Typeflag {
+		case tar.TypeLink:
+			header.hardLink = true
+		case tar.TypeSymlink:
+		default:
+			header.link = ""
+		}
+
+		if err := e.extract(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *extractor) extractZip(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	r, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range r.File {
+		header := archiveHeader{
+			name:    f.Name,
+			mode:    f.Mode(),
+			modTime: f.Modified,
+			size:    int64(f.UncompressedSize64),
+		}
+
+		if header.mode&os.ModeSymlink != 0 {
+			if header.link, err = readZipLink(f); err != nil {
+				return err
+			}
+		}
+
+		if err := e.extractZipFile(f, header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *extractor) extractZipFile(f *zip.File, header archiveHeader) (err error) {
+	if !header.mode.IsRegular() {
+		return e.extract(header, nil)
+	}
+
+	// The declared size may be forged, but exceeding the limit early saves decompressing.
+	if err := e.checkSize(header.name, header.size); err != nil {
+		return err
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+
+	defer CloseInto(&err, r)
+
+	return e.extract(header, r)
+}
+
+// Extracts the entry, whose contents are read from r, if it is a regular file.
+func (e *extractor) extract(header archiveHeader, r io.Reader) error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+
+	if e.entries++; e.maxEntries > 0 && e.entries > e.maxEntries {
+		return &PathError{Op: "extract", Path: e.src, Err: ErrArchiveLimit}
+	}
+
+	rel, err := cleanArchiveName(header.name)
+	if err != nil {
+		return err
+	}
+
+	if err := checkNativeName(header.name, rel); err != nil {
+		return err
+	}
+
+	if rel == "." {
+		if header.mode.IsDir() {
+			e.dirs[rel] = extractedDir{mode: header.mode, modTime: header.modTime}
+			return nil
+		}
+
+		return errNotDir("extract", header.name)
+	}
+
+	dstPath := filepath.Join(e.root, filepath.FromSlash(rel))
+
+	if err := e.makeParents(rel); err != nil {
+		return err
+	}
+
+	if skip, err := e.prepare(dstPath, header.mode); err != nil || skip {
+		return err
+	}
+
+	switch {
+	case header.hardLink:
+		return e.extractHardLink(dstPath, header)
+	case header.mode.IsDir():
+		// The same permissions as implied parents have. Archive ones are applied in the end, so the directory is writable.
+		if err := os.Mkdir(dstPath, 0755); err != nil && !os.IsExist(err) {
+			return err
+		}
+
+		e.dirs[rel] = extractedDir{mode: header.mode, modTime: header.modTime}
+		return nil
+	case header.mode.IsRegular():
+		return e.extractFile(dstPath, header, r)
+	case header.mode&os.ModeSymlink != 0:
+		if err := checkLinkTarget(rel, header.link); err != nil {
+			return err
+		}
+
+		return os.Symlink(filepath.FromSlash(header.link), dstPath)
+	default:
+		return errUnsupportedPathType("extract", header.name)
+	}
+}
+
+// Rejects names, which are unsafe on this OS only, e.g. ones with backslashes or volume names on Windows.
+func checkNativeName(name, rel string) error {
+	native := filepath.FromSlash(rel)
+
+	if filepath.VolumeName(native) != "" {
+		return &PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+	}
+
+	for _, part := range strings.FieldsFunc(native, isNameSeparator) {
+		if part == ".." {
+			return &PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+		}
+	}
+
+	return nil
+}
+
+// Returns true for slashes and separators of this OS, e.g. backslashes on Windows.
+func isNameSeparator(r rune) bool {
+	return r == '/' || r < utf8.RuneSelf && os.IsPathSeparator(uint8(r))
+}
+
+// Rejects absolute targets and targets outside the root.
+// Parent references are allowed only in the beginning, so they never follow other symbolic links.
+func checkLinkTarget(rel, target string) error {
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return &PathError{Op: "extract", Path: rel, Err: ErrUnsafeArchivePath}
+	}
+
+	named := false
+
+	for _, part := range strings.FieldsFunc(target, isNameSeparator) {
+		if part != ".." {
+			named = named || part != "."
+		} else if named {
+			return &PathError{Op: "extract", Path: rel, Err: ErrUnsafeArchivePath}
+		}
+	}
+
+	if resolved := path.Join(path.Dir(rel), filepath.ToSlash(target)); resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return &PathError{Op: "extract", Path: rel, Err: ErrUnsafeArchivePath}
+	}
+
+	return nil
+}
+
+// Creates missing parents of the entry and checks existing ones are directories, but not symbolic links,
+// so nothing is ever written through a link.
+func (e *extractor) makeParents(rel string) error {
+	dirPath := e.root
+
+	for _, part := range strings.Split(path.Dir(rel), "/") {
+		if part == "." {
+			break
+		}
+
+		dirPath = filepath.Join(dirPath, part)
+
+		info, err := os.Lstat(dirPath)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(dirPath, 0755); err != nil {
+				return err
+			}
+
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if isSymlink(info) {
+			return &PathError{Op: "extract", Path: rel, Err: ErrUnsafeArchivePath}
+		}
+
+		if !isDir(info) {
+			return errNotDir("extract", dirPath)
+		}
+	}
+
+	return nil
+}
+
+// Handles an existing destination entry according to the overwrite policy.
+func (e *extractor) prepare(dstPath string, mode os.FileMode) (skip bool, err error) {
+	info, err := os.Lstat(dstPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if mode.IsDir() && isDir(info) {
+		return false, nil
+	}
+
+	switch e.overwrite {
+	case OverwriteAlways:
+		// Regular files are replaced by renaming.
+		if !mode.IsRegular() || !info.Mode().IsRegular() {
+			return false, os.RemoveAll(dstPath)
+		}
+
+		return false, nil
+	case OverwriteSkip:
+		return true, nil
+	default:
+		return false, errExist("extract", dstPath)
+	}
+}
+
+func (e *extractor) checkSize(name string, size int64) error {
+	if e.maxSize > 0 && size > e.maxSize-e.size {
+		return &PathError{Op: "extract", Path: name, Err: ErrArchiveLimit}
+	}
+
+	return nil
+}
+
+// Writes the file into a temporary one next to the destination and renames it.
+func (e *extractor) extractFile(dstPath string, header archiveHeader, r io.Reader) (err error) {
+	if err := e.checkSize(header.name, header.size); err != nil {
+		return err
+	}
+
+	dst, err := ioutil.TempFile(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			closeQuietly(dst)
+			_ = os.Remove(dst.Name())
+		}
+	}()
+
+	// One more byte than allowed tells the limit is exceeded.
+	limit := int64(-1)
+	if e.maxSize > 0 {
+		limit = e.maxSize - e.size + 1
+	}
+
+	n, err := copyContext(e.ctx, dst, r, limit)
+	if err != nil {
+		return err
+	}
+
+	if e.size += n; e.maxSize > 0 && e.size > e.maxSize {
+		return &PathError{Op: "extract", Path: header.name, Err: ErrArchiveLimit}
+	}
+
+	perm := os.FileMode(0644)
+	if e.mode {
+		perm = header.mode.Perm()
+	}
+
+	if err := dst.Chmod(perm); err != nil {
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if e.modTime && !header.modTime.IsZero() {
+		if err := os.Chtimes(dst.Name(), header.modTime, header.modTime); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(dst.Name(), dstPath)
+}
+
+func (e *extractor) extractHardLink(dstPath string, header archiveHeader) error {
+	targetRel, err := cleanArchiveName(header.link)
+	if err != nil {
+		return err
+	}
+
+	if err := checkNativeName(header.link, targetRel); err != nil {
+		return err
+	}
+
+	if err := e.makeParents(targetRel); err != nil {
+		return err
+	}
+
+	targetPath := filepath.Join(e.root, filepath.FromSlash(targetRel))
+
+	info, err := os.Lstat(targetPath)
+	if err != nil {
+		return err
+	}
+
+	if !isFile(info) {
+		return errNotFile("extract", header.link)
+	}
+
+	if e.overwrite == OverwriteAlways {
+		if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Link(targetPath, dstPath)
+}
+
+// Copies at most limit bytes, if it is not negative, checking the context between chunks.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	if limit >= 0 {
+		src = io.LimitReader(src, limit)
+	}
+
+	buf := make([]byte, bufferSize)
+	var written int64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, err := readChunk(src, buf)
+		if _, err := dst.Write(buf[:n]); err != nil {
+			return written, err
+		}
+
+		written += int64(n)
+
+		if errors.Is(err, EOF) {
+			return written, nil
+		} else if err != nil {
+			return written, err
+		}
+	}
+}
+
+// Applies modes and modification times of extracted directories, deepest first.
+func (e *extractor) applyDirsMetadata() error {
+	rels := make([]string, 0, len(e.dirs))
+	for rel := range e.dirs {
+		rels = append(rels, rel)
+	}
+
+	sort.Slice(rels, func(i, j int) bool {
+		if depth1, depth2 := depth(rels[i]), depth(rels[j]); depth1 != depth2 {
+			return depth1 > depth2
+		}
+
+		return rels[i] < rels[j]
+	})
+
+	for _, rel := range rels {
+		dir := e.dirs[rel]
+		dirPath := filepath.Join(e.root, filepath.FromSlash(rel))
+
+		if e.mode {
+			if err := os.Chmod(dirPath, dir.mode.Perm()); err != nil {
+				return err
+			}
+		}
+
+		if e.modTime && !dir.modTime.IsZero() {
+			if err := os.Chtimes(dirPath, dir.modTime, dir.modTime); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	assert.Nil(t, os.Mkdir(srcDir, 0755))
+	copyTestTree(t, diffPath("c1"), srcDir)
+
+	assert.Nil(t, os.Chmod(filepath.Join(srcDir, "s0"), 0750))
+	assert.Nil(t, os.Chmod(filepath.Join(srcDir, "0.bin"), 0700))
+	assert.Nil(t, os.Symlink("../0.bin", filepath.Join(srcDir, "s0", "link")))
+
+	compareOpts := CompareOptions{NoFollowSymlinks: true, ComparePermissions: true}
+
+	for _, name := range []string{"src.tar", "src.tar.gz", "src.zip"} {
+		archivePath := filepath.Join(tempDir, name)
+		if !assert.Nil(t, CreateArchive(srcDir, archivePath, ArchiveOptions{PreserveModTime: true}), name) {
+			continue
+		}
+
+		dstDir := filepath.Join(tempDir, "dst", name)
+		if !assert.Nil(t, ExtractArchive(archivePath, dstDir, ExtractOptions{}), name) {
+			continue
+		}
+
+		diffs, err := DiffDirsContext(context.Background(), srcDir, dstDir, CompareOptions{
+			NoFollowSymlinks: true,
+			CompareModTime:   true,
+			// Symbolic links keep current times, and zip stores times with two-second precision.
+			ModTimeTolerance: 24 * time.Hour,
+		})
+
+		assert.Nil(t, err, name)
+		assert.Empty(t, diffs, name)
+
+		equal, err := DirsEqualContext(context.Background(), srcDir, dstDir, compareOpts)
+		assert.Nil(t, err, name)
+		assert.True(t, equal, name)
+
+		err = ExtractArchive(archivePath, dstDir, ExtractOptions{})
+		assert.True(t, os.IsExist(err), name)
+
+		assert.Nil(t, ExtractArchive(archivePath, dstDir, ExtractOptions{Overwrite: OverwriteSkip}), name)
+		assert.Nil(t, ExtractArchive(archivePath, dstDir, ExtractOptions{Overwrite: OverwriteAlways}), name)
+
+		equal, err = DirsEqualContext(context.Background(), srcDir, dstDir, compareOpts)
+		assert.Nil(t, err, name)
+		assert.True(t, equal, name)
+	}
+}
+
+func TestExtractArchive_NoPreserveMode(t *testing.T) {
+	tempDir := t.TempDir()
+	archivePath := filepath.Join(tempDir, "modes.tar")
+	writeTestTar(
+		t,
+		archivePath,
+		&tar.Header{Typeflag: tar.TypeDir, Name: "listed/", Mode: 0500},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "listed/file.txt", Linkname: "file", Mode: 0600},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "implied/file.txt", Linkname: "file"},
+	)
+
+	dstDir := filepath.Join(tempDir, "dst")
+	if !assert.Nil(t, ExtractArchive(archivePath, dstDir, ExtractOptions{NoPreserveMode: true})) {
+		t.FailNow()
+	}
+
+	// Default permissions are subject to umask.
+	defaultDir := filepath.Join(tempDir, "default")
+	assert.Nil(t, os.Mkdir(defaultDir, 0755))
+
+	expected, err := os.Stat(defaultDir)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	for _, name := range []string{"implied", "listed"} {
+		info, err := os.Stat(filepath.Join(dstDir, name))
+		if assert.Nil(t, err, name) {
+			assert.Equal(t, expected.Mode(), info.Mode(), name)
+		}
+	}
+
+	assertFileContent(t, filepath.Join(dstDir, "listed", "file.txt"), "file")
+}
+
+func TestExtractArchive_Unsafe(t *testing.T) {
+	for name, headers := range map[string][]*tar.Header{
+		"parent":          {{Typeflag: tar.TypeReg, Name: "../evil.txt", Linkname: "evil"}},
+		"nested parent":   {{Typeflag: tar.TypeReg, Name: "a/../../evil.txt", Linkname: "evil"}},
+		"absolute link":   {{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "/etc"}},
+		"outside link":    {{Typeflag: tar.TypeSymlink, Name: "a/link", Linkname: "../../x"}},
+		"link via link":   {{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "a/../.."}},
+		"hard link":       {{Typeflag: tar.TypeLink, Name: "link", Linkname: "../evil.txt"}},
+		"through symlink": {{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "a"}, {Typeflag: tar.TypeReg, Name: "link/evil.txt", Linkname: "evil"}},
+	} {
+		tempDir := t.TempDir()
+		archivePath := filepath.Join(tempDir, "unsafe.tar")
+		writeTestTar(t, archivePath, headers...)
+
+		dstDir := filepath.Join(tempDir, "dst", "dst")
+		err := ExtractArchive(archivePath, dstDir, ExtractOptions{})
+		assert.ErrorIs(t, err, ErrUnsafeArchivePath, name)
+
+		assertDirNames(t, tempDir, "dst", "unsafe.tar")
+		assertDirNames(t, filepath.Join(tempDir, "dst"), "dst")
+	}
+
+	// Links inside the directory are fine.
+	tempDir := t.TempDir()
+	archivePath := filepath.Join(tempDir, "safe.tar")
+	writeTestTar(
+		t,
+		archivePath,
+		&tar.Header{Typeflag: tar.TypeReg, Name: "./a/file.txt", Linkname: "file"},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "a/b/link", Linkname: "../file.txt"},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "a/dot", Linkname: "."},
+		&tar.Header{Typeflag: tar.TypeLink, Name: "a/hard.txt", Linkname: "a/file.txt"},
+	)
+
+	dstDir := filepath.Join(tempDir, "dst")
+	if assert.Nil(t, ExtractArchive(archivePath, dstDir, ExtractOptions{})) {
+		assertFileContent(t, filepath.Join(dstDir, "a", "b", "link"), "file")
+		assertFileContent(t, filepath.Join(dstDir, "a", "hard.txt"), "file")
+		assertDirNames(t, filepath.Join(dstDir, "a"), "b", "dot", "file.txt", "hard.txt")
+	}
+}
+
+func TestExtractArchive_Limits(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tarPath := filepath.Join(tempDir, "entries.tar")
+	writeTestTar(
+		t,
+		tarPath,
+		&tar.Header{Typeflag: tar.TypeReg, Name: "0.txt", Linkname: "0123456789"},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "1.txt", Linkname: "0123456789"},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "2.txt", Linkname: "0123456789"},
+	)
+
+	err := ExtractArchive(tarPath, filepath.Join(tempDir, "entries"), ExtractOptions{MaxEntries: 2})
+	assert.ErrorIs(t, err, ErrArchiveLimit)
+	assertDirNames(t, filepath.Join(tempDir, "entries"), "0.txt", "1.txt")
+
+	err = ExtractArchive(tarPath, filepath.Join(tempDir, "size"), ExtractOptions{MaxSize: 25})
+	assert.ErrorIs(t, err, ErrArchiveLimit)
+	assertDirNames(t, filepath.Join(tempDir, "size"), "0.txt", "1.txt")
+
+	assert.Nil(t, ExtractArchive(tarPath, filepath.Join(tempDir, "exact"), ExtractOptions{MaxSize: 30, MaxEntries: 3}))
+
+	// Highly compressible contents, whose declared size is small.
+	var tarBuf bytes.Buffer
+	tarWriter := tar.NewWriter(&tarBuf)
+	assert.Nil(t, tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "bomb", Size: 1 << 20, Mode: 0644}))
+	_, err = tarWriter.Write(make([]byte, 1<<20))
+	assert.Nil(t, err)
+	assert.Nil(t, tarWriter.Close())
+
+	var gzipBuf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipBuf)
+	_, err = gzipWriter.Write(tarBuf.Bytes())
+	assert.Nil(t, err)
+	assert.Nil(t, gzipWriter.Close())
+
+	bombPath := filepath.Join(tempDir, "bomb.tar.gz")
+	assert.Nil(t, os.WriteFile(bombPath, gzipBuf.Bytes(), 0644))
+
+	err = ExtractArchive(bombPath, filepath.Join(tempDir, "bomb"), ExtractOptions{MaxSize: 1 << 10})
+	assert.ErrorIs(t, err, ErrArchiveLimit)
+
+	empty, err := IsEmpty(filepath.Join(tempDir, "bomb"))
+	assert.Nil(t, err)
+	assert.True(t, empty)
+
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	w, err := zipWriter.Create("bomb")
+	if assert.Nil(t, err) {
+		_, err = w.Write(make([]byte, 1<<20))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, zipWriter.Close())
+
+	bombPath = filepath.Join(tempDir, "bomb.zip")
+	assert.Nil(t, os.WriteFile(bombPath, zipBuf.Bytes(), 0644))
+
+	err = ExtractArchive(bombPath, filepath.Join(tempDir, "zip-bomb"), ExtractOptions{MaxSize: 1 << 10})
+	assert.ErrorIs(t, err, ErrArchiveLimit)
+
+	empty, err = IsEmpty(filepath.Join(tempDir, "zip-bomb"))
+	assert.Nil(t, err)
+	assert.True(t, empty)
+
+	err = ExtractArchive(diffPath("a1/0.bin"), filepath.Join(tempDir, "unknown"), ExtractOptions{})
+	assert.ErrorIs(t, err, ErrUnknownArchiveFormat)
+}
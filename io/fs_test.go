@@ -0,0 +1,107 @@
+package io
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffFSC(t *testing.T) {
+	expected, err := DiffDirs(diffPath("c1"), diffPath("c2"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	for _, opts := range []CompareOptions{
+		{},
+		{Workers: 4},
+		{Digest: DigestSHA256, Content: &CompareFilesOptions{}},
+	} {
+		diffs, err := DiffFSContext(context.Background(), os.DirFS(diffPath("c1")), ".", os.DirFS(diffPath("c2")), ".", opts)
+		if !assert.Nil(t, err) || !assert.Equal(t, len(expected), len(diffs)) {
+			continue
+		}
+
+		for i, diff := range diffs {
+			assert.Equal(t, expected[i].Kind, diff.Kind, diff.Path)
+			assert.Equal(t, expected[i].Path, diff.Path)
+		}
+	}
+
+	equal, err := FSEqual(os.DirFS(testPath()), "diffs/a1", os.DirFS(diffPath("a2")), ".")
+	assert.Nil(t, err)
+	assert.True(t, equal)
+}
+
+func TestDiffFS_MapFS(t *testing.T) {
+	fsys1 := fstest.MapFS{
+		"a.txt":       {Data: []byte("a")},
+		"dir/b.txt":   {Data: []byte("b")},
+		"dir/c.txt":   {Data: []byte("c")},
+		"removed.txt": {Data: []byte("removed")},
+	}
+
+	fsys2 := fstest.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"dir/b.txt": {Data: []byte("B")},
+		"dir/c.txt": {Data: []byte("c")},
+		"dir/d.txt": {Data: []byte("d")},
+	}
+
+	diffs, err := DiffFS(fsys1, ".", fsys2, ".")
+	if assert.Nil(t, err) && assert.Equal(t, 3, len(diffs)) {
+		assert.Equal(t, Diff{Kind: DiffKindContentChanged, Path: "dir/b.txt"}, Diff{Kind: diffs[0].Kind, Path: diffs[0].Path})
+		assert.Equal(t, "dir/b.txt", diffs[0].Item1.FullPath)
+		assert.Equal(t, Diff{Kind: DiffKindAdded, Path: "dir/d.txt"}, Diff{Kind: diffs[1].Kind, Path: diffs[1].Path})
+		assert.Equal(t, Diff{Kind: DiffKindRemoved, Path: "removed.txt"}, Diff{Kind: diffs[2].Kind, Path: diffs[2].Path})
+	}
+
+	equal, err := FSEqual(fsys1, "dir", fsys2, "dir")
+	assert.Nil(t, err)
+	assert.False(t, equal)
+
+	equal, err = FSEqualContext(context.Background(), fsys1, "dir", fsys2, "dir", CompareOptions{Include: []string{"c.txt"}})
+	assert.Nil(t, err)
+	assert.True(t, equal)
+
+	_, err = FSEqual(fsys1, "/", fsys2, ".")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+
+	_, err = FSEqual(fsys1, "a.txt", fsys2, ".")
+	assert.ErrorIs(t, err, ErrNotDir)
+}
+
+func TestFSEqual_Zip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	for _, name := range []string{"0.bin", "1.bin", "empty.txt"} {
+		data, err := os.ReadFile(diffPath("a1/" + name))
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+
+		f, err := w.Create("a1/" + name)
+		if assert.Nil(t, err) {
+			_, err = f.Write(data)
+			assert.Nil(t, err)
+		}
+	}
+
+	assert.Nil(t, w.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	equal, err := FSEqual(r, "a1", os.DirFS(diffPath("a2")), ".")
+	assert.Nil(t, err)
+	assert.True(t, equal)
+}
@@ -0,0 +1,181 @@
+// Package golden checks directories produced by tests against golden directories,
+// which can be rewritten from the actual output with the GOLDEN_UPDATE environment variable, e.g.
+//
+//	GOLDEN_UPDATE=1 go test ./...
+//
+// Test binaries may also opt in to the -golden.update flag with RegisterFlags, e.g.
+//
+//	func TestMain(m *testing.M) {
+//		golden.RegisterFlags(flag.CommandLine)
+//		flag.Parse()
+//		os.Exit(m.Run())
+//	}
+//
+//	go test ./generator -golden.update
+package golden
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SladeThe/common-go/io"
+)
+
+const (
+	UpdateFlag = "golden.update"
+	UpdateEnv  = "GOLDEN_UPDATE"
+)
+
+// Value of the flag, if it is registered.
+var update bool
+
+// RegisterFlags defines the -golden.update flag in the flag set, usually flag.CommandLine.
+// The package registers no flags by itself, so it never conflicts with flags of other packages.
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&update, UpdateFlag, false, "rewrite golden directories from actual test output")
+}
+
+// Updating tells whether golden directories are rewritten instead of checked,
+// i.e. whether the GOLDEN_UPDATE environment variable is true, e.g. "1", or the registered -golden.update flag is set.
+func Updating() bool {
+	if env, err := strconv.ParseBool(os.Getenv(UpdateEnv)); err == nil && env {
+		return true
+	}
+
+	return update
+}
+
+type Options struct {
+	// Options of the comparison. Entries excluded from it are still copied, when golden directories are updated.
+	Compare io.CompareOptions
+
+	// Options of unified diffs of changed files printed on failure.
+	Unified io.UnifiedOptions
+}
+
+// AssertDir checks the actual directory equals the golden one. See AssertDirWithOptions for details.
+func AssertDir(t testing.TB, goldenDir, actualDir string) bool {
+	t.Helper()
+	return AssertDirWithOptions(t, goldenDir, actualDir, Options{})
+}
+
+// AssertDirWithOptions checks the actual directory equals the golden one.
+// Otherwise, the test is marked as failed with a summary of diffs and unified diffs of changed files,
+// where added entries are the ones missing in the golden directory.
+// It returns true iff the directories are equal.
+//
+// In the update mode, see Updating, the golden directory is replaced with a copy of the actual one instead,
+// and true is returned. The golden directory is created together with its parents, if they do not exist.
+func AssertDirWithOptions(t testing.TB, goldenDir, actualDir string, opts Options) bool {
+	t.Helper()
+
+	if Updating() {
+		if err := Update(goldenDir, actualDir); err != nil {
+			t.Fatalf("cannot update golden directory %s: %v", goldenDir, err)
+		}
+
+		t.Logf("updated golden directory %s", goldenDir)
+		return true
+	}
+
+	if _, err := os.Stat(goldenDir); os.IsNotExist(err) {
+		t.Errorf("golden directory %s does not exist, run tests with %s=1 to create it", goldenDir, UpdateEnv)
+		return false
+	}
+
+	diffs, err := io.DiffDirsContext(context.Background(), goldenDir, actualDir, opts.Compare)
+	if err != nil {
+		t.Errorf("cannot compare %s with golden directory %s: %v", actualDir, goldenDir, err)
+		return false
+	}
+
+	if len(diffs) == 0 {
+		return true
+	}
+
+	var message strings.Builder
+	_ = io.WriteSummary(&message, diffs)
+
+	message.WriteString("\n")
+	if err := io.WritePatch(&message, diffs, opts.Unified); err != nil {
+		message.WriteString("cannot render diffs: " + err.Error() + "\n")
+	}
+
+	t.Errorf(
+		"%s differs from golden directory %s, run tests with %s=1 to accept the changes:\n%s",
+		actualDir,
+		goldenDir,
+		UpdateEnv,
+		message.String(),
+	)
+
+	return false
+}
+
+// Update replaces the golden directory with a copy of the actual one.
+// The copy is made next to the golden directory first, so it is left intact, if copying fails.
+// The old golden directory is then moved aside and restored, if the copy cannot be moved in its place.
+func Update(goldenDir, actualDir string) error {
+	goldenAbs, err := filepath.Abs(goldenDir)
+	if err != nil {
+		return err
+	}
+
+	actualAbs, err := filepath.Abs(actualDir)
+	if err != nil {
+		return err
+	}
+
+	if overlap(goldenAbs, actualAbs) || overlap(actualAbs, goldenAbs) {
+		return &io.PathError{Op: "update", Path: goldenDir, Err: os.ErrInvalid}
+	}
+
+	parent := filepath.Dir(goldenAbs)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+
+	tempDir, err := os.MkdirTemp(parent, "."+filepath.Base(goldenAbs)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.RemoveAll(tempDir)
+	}()
+
+	tree := filepath.Join(tempDir, "tree")
+	if err := io.CopyDir(actualAbs, tree, io.CopyOptions{NoPreserveModTime: true}); err != nil {
+		return err
+	}
+
+	old := filepath.Join(tempDir, "old")
+	if err := os.Rename(goldenAbs, old); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		old = ""
+	}
+
+	if err := os.Rename(tree, goldenAbs); err != nil {
+		if old != "" {
+			_ = os.Rename(old, goldenAbs)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Returns true iff the path is the directory itself or inside it.
+func overlap(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && (rel == "." || rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
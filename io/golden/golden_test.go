@@ -0,0 +1,106 @@
+package golden
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SladeThe/common-go/io/iotest"
+)
+
+// recordingT records errors instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+var goldenTree = iotest.Tree{
+	"a.txt":     iotest.File("1\n2\n3\n"),
+	"b/c.txt":   iotest.File("c\n"),
+	"b/d.txt":   iotest.File("d\n"),
+	"empty.txt": iotest.File(""),
+}
+
+func TestAssertDir(t *testing.T) {
+	// Nothing is registered on import.
+	assert.Nil(t, flag.Lookup(UpdateFlag))
+	assert.False(t, Updating())
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(flags)
+	assert.Nil(t, flags.Parse([]string{"-" + UpdateFlag}))
+	assert.True(t, Updating())
+	assert.Nil(t, flags.Parse([]string{"-" + UpdateFlag + "=false"}))
+	assert.False(t, Updating())
+
+	goldenDir := iotest.BuildTree(t, goldenTree)
+	assert.True(t, AssertDir(t, goldenDir, iotest.BuildTree(t, goldenTree)))
+
+	actualDir := iotest.BuildTree(t, iotest.Tree{
+		"a.txt":     iotest.File("1\ntwo\n3\n"),
+		"b/c.txt":   iotest.File("c\n"),
+		"b/e.txt":   iotest.File("e\n"),
+		"empty.txt": iotest.File(""),
+	})
+
+	recorder := &recordingT{TB: t}
+	assert.False(t, AssertDir(recorder, goldenDir, actualDir))
+
+	if assert.Equal(t, 1, len(recorder.errors)) {
+		message := recorder.errors[0]
+
+		for _, expected := range []string{
+			"run tests with GOLDEN_UPDATE=1 to accept the changes",
+			"M  a.txt\nD  b/d.txt\nA  b/e.txt\n",
+			"1 added, 1 removed, 1 content changed\n",
+			" 1\n-2\n+two\n 3\n",
+			"-d\n",
+			"+e\n",
+		} {
+			assert.True(t, strings.Contains(message, expected), expected)
+		}
+	}
+
+	recorder = &recordingT{TB: t}
+	assert.False(t, AssertDir(recorder, filepath.Join(goldenDir, "missing"), actualDir))
+	if assert.Equal(t, 1, len(recorder.errors)) {
+		assert.True(t, strings.Contains(recorder.errors[0], "does not exist"))
+	}
+}
+
+func TestAssertDir_Update(t *testing.T) {
+	t.Setenv(UpdateEnv, "1")
+	assert.True(t, Updating())
+
+	goldenDir := filepath.Join(iotest.BuildTree(t, goldenTree), "testdata", "golden")
+	actualDir := iotest.BuildTree(t, iotest.Tree{"new.txt": iotest.File("new\n"), "empty": iotest.Dir()})
+
+	// Created from scratch.
+	assert.True(t, AssertDir(t, goldenDir, actualDir))
+	iotest.AssertTree(t, goldenDir, iotest.Tree{"new.txt": iotest.File("new\n"), "empty": iotest.Dir()})
+
+	// Replaced completely.
+	assert.True(t, AssertDir(t, goldenDir, iotest.BuildTree(t, goldenTree)))
+	iotest.AssertTree(t, goldenDir, goldenTree)
+
+	entries, err := os.ReadDir(filepath.Dir(goldenDir))
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, "golden", entries[0].Name())
+	}
+
+	t.Setenv(UpdateEnv, "0")
+	assert.False(t, Updating())
+	assert.True(t, AssertDir(t, goldenDir, iotest.BuildTree(t, goldenTree)))
+
+	assert.NotNil(t, Update(goldenDir, filepath.Join(goldenDir, "b")))
+	assert.NotNil(t, Update(filepath.Join(goldenDir, "b"), goldenDir))
+}
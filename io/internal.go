@@ -2,32 +2,40 @@ package io
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 )
 
 const bufferSize = 1 << 20
 
-func errEmptyPath() error {
-	return errors.New("path is empty")
+func errNotFile(op, path string) error {
+	return &PathError{Op: op, Path: path, Err: ErrNotFile}
 }
 
-func errNotFile(path string) error {
-	return fmt.Errorf("not a file: %s", path)
+func errNotDir(op, path string) error {
+	return &PathError{Op: op, Path: path, Err: ErrNotDir}
 }
 
-func errNotDir(path string) error {
-	return fmt.Errorf("not a directory: %s", path)
+func errExist(op, path string) error {
+	return &PathError{Op: op, Path: path, Err: os.ErrExist}
+}
+
+func errUnsupportedPathType(op, path string) error {
+	return &PathError{Op: op, Path: path, Err: ErrUnsupportedPathType}
 }
 
 func exists(path string) (bool, error) {
 	if len(path) <= 0 {
-		return false, errEmptyPath()
+		return false, ErrEmptyPath
 	}
 
 	_, err := os.Stat(path)
@@ -54,7 +62,7 @@ func isSymlink(info os.FileInfo) bool {
 
 func isFileOrDir(path string, dir bool) (bool, error) {
 	if len(path) <= 0 {
-		return false, errEmptyPath()
+		return false, ErrEmptyPath
 	}
 
 	info, err := os.Stat(path)
@@ -69,7 +77,7 @@ func isFileOrDir(path string, dir bool) (bool, error) {
 
 func isEmpty(path string) (bool, error) {
 	if len(path) <= 0 {
-		return false, errEmptyPath()
+		return false, ErrEmptyPath
 	}
 
 	info, err := os.Stat(path)
@@ -107,7 +115,7 @@ func isEmpty(path string) (bool, error) {
 
 func parent(path string) (string, error) {
 	if len(path) <= 0 {
-		return "", errEmptyPath()
+		return "", ErrEmptyPath
 	}
 
 	abs, err := filepath.Abs(path)
@@ -117,7 +125,7 @@ func parent(path string) (string, error) {
 
 	parent := filepath.Dir(abs)
 	if len(parent) <= 0 {
-		return "", fmt.Errorf("parent is empty: %s", path)
+		return "", &PathError{Op: "parent", Path: path, Err: errNoParent}
 	}
 
 	parent, err = filepath.Abs(parent)
@@ -126,7 +134,7 @@ func parent(path string) (string, error) {
 	}
 
 	if parent == abs || parent == path {
-		return "", fmt.Errorf("parent equals to absolute path: %s", path)
+		return "", &PathError{Op: "parent", Path: path, Err: errNoParent}
 	}
 
 	return parent, nil
@@ -145,31 +153,24 @@ func isParentDir(path string) (bool, error) {
 	}
 }
 
-func checkFileOrDir(path string, dir bool) (*FileInfo, error) {
-	if len(path) <= 0 {
-		return nil, errEmptyPath()
-	}
-
-	info, err := os.Stat(path)
+// Returns info of the path, if it is a directory or a regular file, as requested, or an error of the operation.
+func checkFileOrDir(op, path string, dir bool) (*FileInfo, error) {
+	info, err := newFileInfo(path, true)
 	if err != nil {
 		return nil, err
 	}
 
-	{
-		info := &FileInfo{FileInfo: info, FullPath: path}
-
-		if dir {
-			if !isDir(info) {
-				return info, errNotDir(path)
-			}
-		} else {
-			if !isFile(info) {
-				return info, errNotFile(path)
-			}
+	if dir {
+		if !isDir(info) {
+			return info, errNotDir(op, path)
+		}
+	} else {
+		if !isFile(info) {
+			return info, errNotFile(op, path)
 		}
-
-		return info, nil
 	}
+
+	return info, nil
 }
 
 func closeMany(closers ...io.Closer) error {
@@ -186,6 +187,25 @@ func closeMany(closers ...io.Closer) error {
 	return firstErr
 }
 
+// Closes all closers and combines their errors, wrapped into CloseError, into MultiError.
+func closeAll(closers ...io.Closer) error {
+	var errs MultiError
+
+	for i, c := range closers {
+		if c != nil {
+			if err := c.Close(); err != nil {
+				errs = append(errs, &CloseError{Index: i, Closer: c, Err: err})
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
 func closeQuietly(closers ...io.Closer) {
 	for _, c := range closers {
 		if c != nil {
@@ -219,31 +239,42 @@ func readChunk(r io.Reader, buf []byte) (count int, err error) {
 	return
 }
 
-func readersContentEqual(r1, r2 io.Reader) (bool, error) {
+// Set concurrent to true to read both readers simultaneously, which is faster for readers backed by different devices.
+// The context is checked between chunks.
+func readersContentEqual(ctx context.Context, r1, r2 io.Reader, concurrent bool) (bool, error) {
 	buf1 := make([]byte, bufferSize)
 	buf2 := make([]byte, bufferSize)
 
 	var wg sync.WaitGroup
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
 		var (
 			n1, n2     int
 			err1, err2 error
 		)
 
-		wg.Add(2)
+		if concurrent {
+			wg.Add(2)
 
-		go func() {
-			defer wg.Done()
-			n1, err1 = readChunk(r1, buf1)
-		}()
+			go func() {
+				defer wg.Done()
+				n1, err1 = readChunk(r1, buf1)
+			}()
 
-		go func() {
-			defer wg.Done()
-			n2, err2 = readChunk(r2, buf2)
-		}()
+			go func() {
+				defer wg.Done()
+				n2, err2 = readChunk(r2, buf2)
+			}()
 
-		wg.Wait()
+			wg.Wait()
+		} else {
+			n1, err1 = readChunk(r1, buf1)
+			n2, err2 = readChunk(r2, buf2)
+		}
 
 		eof1 := errors.Is(err1, EOF)
 		if err1 != nil && !eof1 {
@@ -265,7 +296,7 @@ func readersContentEqual(r1, r2 io.Reader) (bool, error) {
 	}
 }
 
-func readClosersContentEqual(r1, r2 io.ReadCloser, close1, close2 bool) (bool, error) {
+func readClosersContentEqual(ctx context.Context, r1, r2 io.ReadCloser, close1, close2, concurrent bool) (bool, error) {
 	var closers [2]io.Closer
 	if close1 {
 		closers[0] = r1
@@ -274,7 +305,7 @@ func readClosersContentEqual(r1, r2 io.ReadCloser, close1, close2 bool) (bool, e
 		closers[1] = r2
 	}
 
-	equals, err := readersContentEqual(r1, r2)
+	equals, err := readersContentEqual(ctx, r1, r2, concurrent)
 	if err != nil {
 		closeQuietly(closers[:]...)
 		return equals, err
@@ -301,206 +332,852 @@ func absolutePathsEqual(path1, path2 string) (bool, error) {
 	return abs1 == abs2, nil
 }
 
-func pathsEqual(path1, path2 string, diffs *[]Diff) (bool, error) {
-	if equal, err := absolutePathsEqual(path1, path2); err != nil {
-		return false, err
-	} else if equal {
-		return true, nil
+func (opts *CompareOptions) validate() error {
+	if opts.Digest != DigestNone {
+		if _, err := opts.Digest.newHash(); err != nil {
+			return err
+		}
 	}
 
-	info1, err := os.Stat(path1)
-	notExists1 := os.IsNotExist(err)
-	if err != nil && !notExists1 {
-		return false, err
+	for _, patterns := range [][]string{opts.Include, opts.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
 	}
 
-	info2, err := os.Stat(path2)
-	notExists2 := os.IsNotExist(err)
-	if err != nil && !notExists2 {
-		return false, err
+	return nil
+}
+
+func (opts *CompareOptions) stat(path string) (os.FileInfo, error) {
+	if opts.NoFollowSymlinks {
+		return os.Lstat(path)
 	}
 
-	if notExists1 && notExists2 {
-		return true, nil
+	return os.Stat(path)
+}
+
+// Same as stat, but describes a dangling symbolic link itself instead of failing, when links are followed.
+func (opts *CompareOptions) statOrLink(path string) (os.FileInfo, error) {
+	info, err := opts.stat(path)
+	if err != nil && !opts.NoFollowSymlinks && os.IsNotExist(err) {
+		if linkInfo, linkErr := os.Lstat(path); linkErr == nil && isSymlink(linkInfo) {
+			return linkInfo, nil
+		}
 	}
 
-	if notExists1 != notExists2 {
-		if diffs != nil {
-			if notExists2 {
-				*diffs = append(*diffs, Diff{Item1: &FileInfo{FileInfo: info1, FullPath: path1}})
-			} else {
-				*diffs = append(*diffs, Diff{Item2: &FileInfo{FileInfo: info2, FullPath: path2}})
-			}
+	return info, err
+}
+
+func matchesGlobs(patterns []string, rel, name string) bool {
+	for _, pattern := range patterns {
+		// Patterns are validated beforehand, so errors are impossible here.
+		if matched, _ := path.Match(pattern, rel); matched {
+			return true
 		}
 
-		return false, nil
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
 	}
 
-	updateDiffs := func() {
-		if diffs != nil {
-			*diffs = append(*diffs, Diff{
-				Item1: &FileInfo{FileInfo: info1, FullPath: path1},
-				Item2: &FileInfo{FileInfo: info2, FullPath: path2},
-			})
+	return false
+}
+
+func matchesRegexps(regexps []*regexp.Regexp, rel string) bool {
+	for _, re := range regexps {
+		if re.MatchString(rel) {
+			return true
 		}
 	}
 
-	if isFile(info1) {
-		if isFile(info2) {
-			return filesEqual(path1, path2, diffs)
-		} else if isDir(info2) {
-			updateDiffs()
-			return false, nil
-		} else {
-			return false, fmt.Errorf("unsupported path type: %v", path2)
+	return false
+}
+
+// Returns true iff the entry must be compared according to the options.
+func (opts *CompareOptions) accepts(rel, name string, dir bool) bool {
+	if opts.Hidden == HiddenExclude && strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	if matchesGlobs(opts.Exclude, rel, name) || matchesRegexps(opts.ExcludeRegexps, rel) {
+		return false
+	}
+
+	if dir || len(opts.Include) == 0 && len(opts.IncludeRegexps) == 0 {
+		return true
+	}
+
+	return matchesGlobs(opts.Include, rel, name) || matchesRegexps(opts.IncludeRegexps, rel)
+}
+
+func (opts *CompareOptions) includes() bool {
+	return len(opts.Include) > 0 || len(opts.IncludeRegexps) > 0
+}
+
+// Returns the accepted entries, reusing the slice.
+// If there are include patterns, directories are accepted only if they contain included entries.
+// The results are memoised in included, which must be the same for the whole traversal of the tree.
+func (opts *CompareOptions) filter(t tree, dirPath, rel string, infos []os.FileInfo, included includedDirs) []os.FileInfo {
+	filtered := infos[:0]
+
+	for _, info := range infos {
+		itemPath := t.join(dirPath, info.Name())
+		itemRel := relativePath(rel, info.Name())
+		dir := opts.isDir(t, itemPath, info)
+
+		if !opts.accepts(itemRel, info.Name(), dir) {
+			continue
+		}
+
+		if dir && opts.includes() {
+			if has, _ := opts.hasIncluded(t, itemPath, itemRel, included, make(map[inodeKey]bool)); !has {
+				continue
+			}
 		}
+
+		filtered = append(filtered, info)
 	}
 
-	if isDir(info1) {
-		if isFile(info2) {
-			updateDiffs()
-			return false, nil
-		} else if isDir(info2) {
-			return dirsEqual(path1, path2, diffs)
-		} else {
-			return false, fmt.Errorf("unsupported path type: %v", path2)
+	return filtered
+}
+
+// Same as filter, but keeps entries accepted in either tree, so an entry,
+// which is an included file in one tree and a directory without included entries in another, is a type change.
+func (opts *CompareOptions) filterPair(
+	t1 tree, dirPath1 string, infos1 []os.FileInfo, included1 includedDirs,
+	t2 tree, dirPath2 string, infos2 []os.FileInfo, included2 includedDirs,
+	rel string,
+) ([]os.FileInfo, []os.FileInfo) {
+	if !opts.includes() {
+		return opts.filter(t1, dirPath1, rel, infos1, included1), opts.filter(t2, dirPath2, rel, infos2, included2)
+	}
+
+	accepted := make(map[string]bool)
+
+	for _, info := range opts.filter(t1, dirPath1, rel, append([]os.FileInfo(nil), infos1...), included1) {
+		accepted[info.Name()] = true
+	}
+
+	for _, info := range opts.filter(t2, dirPath2, rel, append([]os.FileInfo(nil), infos2...), included2) {
+		accepted[info.Name()] = true
+	}
+
+	keep := func(infos []os.FileInfo) []os.FileInfo {
+		filtered := infos[:0]
+
+		for _, info := range infos {
+			if accepted[info.Name()] {
+				filtered = append(filtered, info)
+			}
+		}
+
+		return filtered
+	}
+
+	return keep(infos1), keep(infos2)
+}
+
+// Tells whether the entry is a directory, following symbolic links, unless the options forbid it.
+func (opts *CompareOptions) isDir(t tree, itemPath string, info os.FileInfo) bool {
+	if !opts.NoFollowSymlinks && isSymlink(info) {
+		if target, err := t.stat(itemPath, true); err == nil {
+			return isDir(target)
 		}
 	}
 
-	return false, fmt.Errorf("unsupported path type: %v", path1)
+	return isDir(info)
 }
 
-func filesEqual(path1, path2 string, diffs *[]Diff) (bool, error) {
-	info1, err := checkFileOrDir(path1, false)
+// Memoised results of hasIncluded by directory paths in a single tree.
+type includedDirs map[string]bool
+
+// Returns true iff the directory subtree contains an included entry other than a directory.
+// Unreadable directories are assumed to contain one, so they are compared and their errors are reported.
+//
+// Directories reached again through followed links are not walked again within a call.
+// Values of visitedDirs tell whether the directory is still being walked, i.e. is an ancestor.
+// The result is incomplete and not memoised, if it skips an ancestor, which may yet turn out to have included entries.
+func (opts *CompareOptions) hasIncluded(
+	t tree,
+	dirPath, rel string,
+	included includedDirs,
+	visitedDirs map[inodeKey]bool,
+) (has, complete bool) {
+	if has, ok := included[dirPath]; ok {
+		return has, true
+	}
+
+	if info, err := t.stat(dirPath, true); err == nil {
+		if dev, ino, _, ok := fileInode(info); ok {
+			key := inodeKey{dev: dev, ino: ino}
+			if walking, ok := visitedDirs[key]; ok {
+				return false, !walking
+			}
+
+			visitedDirs[key] = true
+			defer func() { visitedDirs[key] = false }()
+		}
+	}
+
+	infos, err := t.readDir(dirPath)
 	if err != nil {
-		return false, err
+		included[dirPath] = true
+		return true, true
+	}
+
+	complete = true
+
+	for _, info := range infos {
+		itemPath := t.join(dirPath, info.Name())
+		itemRel := relativePath(rel, info.Name())
+		dir := opts.isDir(t, itemPath, info)
+
+		if !opts.accepts(itemRel, info.Name(), dir) {
+			continue
+		}
+
+		if !dir {
+			included[dirPath] = true
+			return true, true
+		}
+
+		itemHas, itemComplete := opts.hasIncluded(t, itemPath, itemRel, included, visitedDirs)
+		if itemHas {
+			included[dirPath] = true
+			return true, true
+		}
+
+		complete = complete && itemComplete
+	}
+
+	if complete {
+		included[dirPath] = false
+	}
+
+	return false, complete
+}
+
+type inodeKey struct {
+	dev, ino uint64
+}
+
+// Walks the directory tree in the order of names, calling visit for every entry accepted by the options,
+// except the root itself. Entries are described by opts.statOrLink, so symbolic links are followed by default,
+// while dangling ones are visited as links.
+// A directory reached several times through followed links is visited every time, but entered only once.
+func walkTree(
+	ctx context.Context,
+	opts *CompareOptions,
+	root string,
+	rootInfo os.FileInfo,
+	visit func(path, rel string, info os.FileInfo) error,
+) error {
+	visitedDirs := make(map[inodeKey]bool)
+	included := make(includedDirs)
+
+	// Returns false, if the directory has been entered before.
+	enter := func(info os.FileInfo) bool {
+		dev, ino, _, ok := fileInode(info)
+		if !ok {
+			return true
+		}
+
+		key := inodeKey{dev: dev, ino: ino}
+		if visitedDirs[key] {
+			return false
+		}
+
+		visitedDirs[key] = true
+		return true
 	}
 
-	info2, err := checkFileOrDir(path2, false)
+	var walk func(dirPath, rel string) error
+	walk = func(dirPath, rel string) error {
+		if opts.tooDeep(rel) {
+			return nil
+		}
+
+		infos, err := ioutil.ReadDir(dirPath)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range opts.filter(osFiles, dirPath, rel, infos, included) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			itemPath := filepath.Join(dirPath, info.Name())
+			itemRel := relativePath(rel, info.Name())
+
+			if info, err = opts.statOrLink(itemPath); err != nil {
+				return err
+			}
+
+			if err := visit(itemPath, itemRel, info); err != nil {
+				return err
+			}
+
+			if isDir(info) && enter(info) {
+				if err := walk(itemPath, itemRel); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	enter(rootInfo)
+	return walk(root, ".")
+}
+
+// Returns true iff the children of the entry must not be compared because of the maximum depth.
+func (opts *CompareOptions) tooDeep(rel string) bool {
+	return opts.MaxDepth > 0 && depth(rel) >= opts.MaxDepth
+}
+
+func depth(rel string) int {
+	if rel == "." {
+		return 0
+	}
+
+	return strings.Count(rel, "/") + 1
+}
+
+func relativePath(parent, name string) string {
+	return path.Join(parent, name)
+}
+
+func removedDiff(t tree, info os.FileInfo, fullPath, rel string) Diff {
+	return Diff{Kind: DiffKindRemoved, Path: rel, Item1: treeFileInfo(t, info, fullPath)}
+}
+
+func addedDiff(t tree, info os.FileInfo, fullPath, rel string) Diff {
+	return Diff{Kind: DiffKindAdded, Path: rel, Item2: treeFileInfo(t, info, fullPath)}
+}
+
+const permissionBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+func (opts *CompareOptions) metadataReasons(info1, info2 os.FileInfo) DiffReason {
+	var reasons DiffReason
+
+	if opts.ComparePermissions && info1.Mode()&permissionBits != info2.Mode()&permissionBits {
+		reasons |= DiffReasonPermissions
+	}
+
+	if opts.CompareModTime {
+		delta := info1.ModTime().Sub(info2.ModTime())
+		if delta < 0 {
+			delta = -delta
+		}
+
+		if delta > opts.ModTimeTolerance {
+			reasons |= DiffReasonModTime
+		}
+	}
+
+	if opts.CompareOwnership {
+		uid1, gid1, ok1 := fileOwner(info1)
+		uid2, gid2, ok2 := fileOwner(info2)
+
+		if ok1 && ok2 && (uid1 != uid2 || gid1 != gid2) {
+			reasons |= DiffReasonOwnership
+		}
+	}
+
+	return reasons
+}
+
+// comparison holds the state of a single comparison of two trees.
+type comparison struct {
+	ctx  context.Context
+	opts *CompareOptions
+
+	// Trees of the first and the second compared directories.
+	tree1, tree2 tree
+
+	// Memoised directory filtering of the trees, see hasIncluded.
+	included1, included2 includedDirs
+
+	// Called for every found diff in the traversal order.
+	// Nil means only equality is checked, so the comparison stops at the first difference.
+	visit WalkDiffFunc
+
+	// Nil means files are compared sequentially.
+	pool *comparePool
+
+	// Entries with this slash-terminated prefix are skipped, see SkipDir.
+	// Guarded by the mutex, because the pool visits diffs concurrently with the traversal.
+	skipMu     sync.Mutex
+	skipPrefix string
+}
+
+func newComparison(ctx context.Context, opts *CompareOptions, tree1, tree2 tree, visit WalkDiffFunc) *comparison {
+	c := &comparison{
+		ctx:       ctx,
+		opts:      opts,
+		tree1:     tree1,
+		tree2:     tree2,
+		included1: make(includedDirs),
+		included2: make(includedDirs),
+		visit:     visit,
+	}
+
+	if opts.Workers > 1 {
+		var emit func(diff Diff) error
+		if visit != nil {
+			emit = c.emit
+		}
+
+		// The pool cancels the context on stop to abort pending file comparisons.
+		c.ctx, c.pool = newComparePool(ctx, opts.Workers, emit)
+	}
+
+	return c
+}
+
+// Waits for all pending file comparisons and combines their results with the result of the tree traversal.
+func (c *comparison) finish(equal bool, err error) (bool, error) {
+	if c.pool == nil {
+		return equal, err
+	}
+
+	poolEqual, poolErr := c.pool.close()
 	if err != nil {
 		return false, err
 	}
+	if poolErr != nil {
+		return false, poolErr
+	}
 
-	if equal, err := absolutePathsEqual(path1, path2); err != nil {
+	return equal && poolEqual, nil
+}
+
+// Returns true iff the pool has stopped, because the result is already known or an error occurred.
+func (c *comparison) stopped() bool {
+	return c.pool != nil && c.pool.stopped()
+}
+
+func (c *comparison) skipped(rel string) bool {
+	c.skipMu.Lock()
+	defer c.skipMu.Unlock()
+
+	return c.skipPrefix != "" && strings.HasPrefix(rel, c.skipPrefix)
+}
+
+func (c *comparison) skip(prefix string) {
+	c.skipMu.Lock()
+	defer c.skipMu.Unlock()
+
+	c.skipPrefix = prefix
+}
+
+// Passes the diff to the visitor, unless it is skipped, and handles SkipDir.
+func (c *comparison) emit(diff Diff) error {
+	if c.skipped(diff.Path) {
+		return nil
+	}
+
+	err := c.visit(diff)
+	if err != SkipDir {
+		return err
+	}
+
+	if diff.Item1 != nil && diff.Item2 != nil && isDir(diff.Item1) && isDir(diff.Item2) {
+		c.skip(diff.Path + "/")
+		return nil
+	}
+
+	if parent := path.Dir(diff.Path); parent != "." {
+		c.skip(parent + "/")
+		return nil
+	}
+
+	return SkipAll
+}
+
+func (c *comparison) report(diff Diff) error {
+	if c.visit == nil {
+		return nil
+	}
+
+	if c.pool != nil {
+		c.pool.report(diff)
+		return nil
+	}
+
+	return c.emit(diff)
+}
+
+func (c *comparison) pathsEqual(path1, path2, rel string) (bool, error) {
+	if c.skipped(rel) {
+		return true, nil
+	}
+
+	if equal, err := samePaths(c.tree1, path1, c.tree2, path2); err != nil {
 		return false, err
 	} else if equal {
 		return true, nil
 	}
 
-	file1, err := os.Open(path1)
-	if err != nil {
+	info1, err := c.tree1.stat(path1, !c.opts.NoFollowSymlinks)
+	notExists1 := os.IsNotExist(err)
+	if err != nil && !notExists1 {
 		return false, err
 	}
 
-	file2, err := os.Open(path2)
-	if err != nil {
+	info2, err := c.tree2.stat(path2, !c.opts.NoFollowSymlinks)
+	notExists2 := os.IsNotExist(err)
+	if err != nil && !notExists2 {
 		return false, err
 	}
 
-	if equal, err := readClosersContentEqual(file1, file2, true, true); err != nil {
-		return false, err
-	} else if equal {
+	if notExists1 && notExists2 {
 		return true, nil
 	}
 
-	if diffs != nil {
-		*diffs = append(*diffs, Diff{Item1: info1, Item2: info2})
+	if notExists1 != notExists2 {
+		if notExists2 {
+			return false, c.report(removedDiff(c.tree1, info1, path1, rel))
+		}
+
+		return false, c.report(addedDiff(c.tree2, info2, path2, rel))
 	}
 
-	return false, nil
+	diff := Diff{
+		Path:  rel,
+		Item1: treeFileInfo(c.tree1, info1, path1),
+		Item2: treeFileInfo(c.tree2, info2, path2),
+	}
+
+	if info1.Mode().Type() != info2.Mode().Type() {
+		diff.Kind = DiffKindTypeChanged
+		return false, c.report(diff)
+	}
+
+	diff.Reasons = c.opts.metadataReasons(info1, info2)
+	if diff.Reasons != 0 && c.visit == nil {
+		return false, nil
+	}
+
+	contentEqual := true
+
+	switch {
+	case isDir(info1):
+		if diff.Reasons != 0 {
+			diff.Kind = DiffKindMetadataChanged
+			if err := c.report(diff); err != nil {
+				return false, err
+			}
+		}
+
+		equal, err := c.dirsEqual(path1, path2, rel)
+		return equal && diff.Reasons == 0, err
+	case isFile(info1):
+		return c.filesEqual(diff)
+	case isSymlink(info1):
+		if contentEqual, err = c.symlinksEqual(path1, path2); err != nil {
+			return false, err
+		} else if !contentEqual {
+			diff.Reasons |= DiffReasonSymlinkTarget
+		}
+	default:
+		// Devices, named pipes and sockets have no content to read, so only device numbers are compared.
+		rdev1, ok1 := fileDevice(info1)
+		rdev2, ok2 := fileDevice(info2)
+		if !ok1 || !ok2 {
+			return false, errUnsupportedPathType("compare", path1)
+		}
+
+		contentEqual = rdev1 == rdev2
+	}
+
+	if !contentEqual {
+		diff.Kind = DiffKindContentChanged
+		return false, c.report(diff)
+	}
+
+	if diff.Reasons != 0 {
+		diff.Kind = DiffKindMetadataChanged
+		return false, c.report(diff)
+	}
+
+	return true, nil
 }
 
-func dirsEqual(path1, path2 string, diffs *[]Diff) (bool, error) {
-	_, err := checkFileOrDir(path1, true)
+// Compares contents of two regular files, described by the diff, which is reported, if they are not equal.
+// The comparison is postponed, if files are compared concurrently, and true is returned immediately.
+func (c *comparison) filesEqual(diff Diff) (bool, error) {
+	if diff.Item1.Size() != diff.Item2.Size() && c.opts.Content == nil {
+		diff.Kind = DiffKindContentChanged
+		return false, c.report(diff)
+	}
+
+	compare := func() (*Diff, error) {
+		contentEqual, err := c.fileContentsEqual(&diff)
+		if err != nil {
+			return nil, err
+		}
+
+		if !contentEqual {
+			diff.Kind = DiffKindContentChanged
+		} else if diff.Reasons != 0 {
+			diff.Kind = DiffKindMetadataChanged
+		} else {
+			return nil, nil
+		}
+
+		return &diff, nil
+	}
+
+	if c.pool != nil {
+		c.pool.submit(compare)
+		return true, nil
+	}
+
+	if diff, err := compare(); err != nil {
+		return false, err
+	} else if diff != nil {
+		return false, c.report(*diff)
+	}
+
+	return true, nil
+}
+
+func (c *comparison) dirsEqual(path1, path2, rel string) (bool, error) {
+	_, err := checkTreeDir("compare", c.tree1, path1)
 	if err != nil {
 		return false, err
 	}
 
-	_, err = checkFileOrDir(path2, true)
+	_, err = checkTreeDir("compare", c.tree2, path2)
 	if err != nil {
 		return false, err
 	}
 
-	if equal, err := absolutePathsEqual(path1, path2); err != nil {
+	if equal, err := samePaths(c.tree1, path1, c.tree2, path2); err != nil {
 		return false, err
 	} else if equal {
 		return true, nil
 	}
 
-	infos1, err := ioutil.ReadDir(path1)
+	if c.opts.tooDeep(rel) {
+		return true, nil
+	}
+
+	infos1, err := c.tree1.readDir(path1)
 	if err != nil {
 		return false, err
 	}
 
-	infos2, err := ioutil.ReadDir(path2)
+	infos2, err := c.tree2.readDir(path2)
 	if err != nil {
 		return false, err
 	}
 
-	if diffs == nil && len(infos1) != len(infos2) {
+	infos1, infos2 = c.opts.filterPair(c.tree1, path1, infos1, c.included1, c.tree2, path2, infos2, c.included2, rel)
+
+	if c.visit == nil && len(infos1) != len(infos2) {
 		return false, nil
 	}
 
-	var itemDiffs []Diff
+	equal := true
 	var pos1, pos2 int
 
 	for pos1 < len(infos1) && pos2 < len(infos2) {
+		if c.stopped() {
+			return false, nil
+		}
+
+		if err := c.ctx.Err(); err != nil {
+			return false, err
+		}
+
 		itemInfo1 := infos1[pos1]
 		itemInfo2 := infos2[pos2]
 
-		itemPath1 := filepath.Join(path1, itemInfo1.Name())
-		itemPath2 := filepath.Join(path2, itemInfo2.Name())
+		itemPath1 := c.tree1.join(path1, itemInfo1.Name())
+		itemPath2 := c.tree2.join(path2, itemInfo2.Name())
 
 		if itemInfo1.Name() != itemInfo2.Name() {
-			if diffs == nil {
+			if c.visit == nil {
 				return false, nil
 			}
 
+			equal = false
+
+			var err error
 			if itemInfo1.Name() < itemInfo2.Name() {
-				itemDiffs = append(itemDiffs, Diff{Item1: &FileInfo{FileInfo: itemInfo1, FullPath: itemPath1}})
+				err = c.report(removedDiff(c.tree1, itemInfo1, itemPath1, relativePath(rel, itemInfo1.Name())))
 				pos1++
 			} else {
-				itemDiffs = append(itemDiffs, Diff{Item2: &FileInfo{FileInfo: itemInfo2, FullPath: itemPath2}})
+				err = c.report(addedDiff(c.tree2, itemInfo2, itemPath2, relativePath(rel, itemInfo2.Name())))
 				pos2++
 			}
 
+			if err != nil {
+				return false, err
+			}
+
 			continue
 		}
 
 		pos1++
 		pos2++
 
-		if equal, err := pathsEqual(itemPath1, itemPath2, &itemDiffs); err != nil {
+		if itemEqual, err := c.pathsEqual(itemPath1, itemPath2, relativePath(rel, itemInfo1.Name())); err != nil {
 			return false, err
-		} else if !equal {
-			if diffs == nil {
+		} else if !itemEqual {
+			if c.visit == nil {
 				return false, nil
 			}
 
-			continue
+			equal = false
 		}
 	}
 
-	if diffs != nil {
-		for pos1 < len(infos1) {
-			itemInfo1 := infos1[pos1]
-			itemPath1 := filepath.Join(path1, itemInfo1.Name())
-			itemDiffs = append(itemDiffs, Diff{Item1: &FileInfo{FileInfo: itemInfo1, FullPath: itemPath1}})
-			pos1++
+	for ; pos1 < len(infos1); pos1++ {
+		equal = false
+		itemInfo1 := infos1[pos1]
+		itemPath1 := c.tree1.join(path1, itemInfo1.Name())
+		if err := c.report(removedDiff(c.tree1, itemInfo1, itemPath1, relativePath(rel, itemInfo1.Name()))); err != nil {
+			return false, err
 		}
+	}
 
-		for pos2 < len(infos2) {
-			itemInfo2 := infos2[pos2]
-			itemPath2 := filepath.Join(path2, itemInfo2.Name())
-			itemDiffs = append(itemDiffs, Diff{Item2: &FileInfo{FileInfo: itemInfo2, FullPath: itemPath2}})
-			pos2++
+	for ; pos2 < len(infos2); pos2++ {
+		equal = false
+		itemInfo2 := infos2[pos2]
+		itemPath2 := c.tree2.join(path2, itemInfo2.Name())
+		if err := c.report(addedDiff(c.tree2, itemInfo2, itemPath2, relativePath(rel, itemInfo2.Name()))); err != nil {
+			return false, err
 		}
+	}
 
-		if len(itemDiffs) > 0 {
-			*diffs = append(*diffs, itemDiffs...)
-			return false, nil
+	return equal, nil
+}
+
+func (c *comparison) symlinksEqual(path1, path2 string) (bool, error) {
+	target1, err := c.tree1.readlink(path1)
+	if err != nil {
+		return false, err
+	}
+
+	target2, err := c.tree2.readlink(path2)
+	if err != nil {
+		return false, err
+	}
+
+	return target1 == target2, nil
+}
+
+// Compares contents of two regular files and fills diff.Content, if requested by the options.
+func (c *comparison) fileContentsEqual(diff *Diff) (bool, error) {
+	info1, info2 := diff.Item1, diff.Item2
+
+	if info1.Size() == info2.Size() {
+		if c.opts.Digest != DigestNone {
+			equal, err := c.fileDigestsEqual(info1, info2)
+			if err != nil || equal || c.opts.Content == nil {
+				return equal, err
+			}
+		} else if c.opts.Content == nil {
+			file1, file2, err := openPair(c.tree1, info1.FullPath, c.tree2, info2.FullPath)
+			if err != nil {
+				return false, err
+			}
+
+			return readClosersContentEqual(c.ctx, file1, file2, true, true, c.pool == nil)
 		}
+	} else if c.opts.Content == nil {
+		return false, nil
 	}
 
-	return true, nil
+	file1, file2, err := openPair(c.tree1, info1.FullPath, c.tree2, info2.FullPath)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := compareReadClosers(c.ctx, file1, file2, c.opts.Content, c.pool == nil)
+	if err != nil {
+		return false, err
+	} else if content.Equal {
+		return true, nil
+	}
+
+	diff.Content = content
+	return false, nil
+}
+
+func (c *comparison) fileDigestsEqual(info1, info2 *FileInfo) (bool, error) {
+	digest1, err := fileInfoDigest(c.ctx, info1, c.opts.Digest, c.opts.DigestCache)
+	if err != nil {
+		return false, err
+	}
+
+	digest2, err := fileInfoDigest(c.ctx, info2, c.opts.Digest, c.opts.DigestCache)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(digest1, digest2), nil
+}
+
+func fileContentsEqual(ctx context.Context, path1, path2 string, concurrent bool) (bool, error) {
+	file1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+
+	file2, err := os.Open(path2)
+	if err != nil {
+		closeQuietly(file1)
+		return false, err
+	}
+
+	return readClosersContentEqual(ctx, file1, file2, true, true, concurrent)
+}
+
+func filesEqual(ctx context.Context, path1, path2 string) (bool, error) {
+	info1, err := checkFileOrDir("compare", path1, false)
+	if err != nil {
+		return false, err
+	}
+
+	info2, err := checkFileOrDir("compare", path2, false)
+	if err != nil {
+		return false, err
+	}
+
+	if equal, err := absolutePathsEqual(path1, path2); err != nil {
+		return false, err
+	} else if equal {
+		return true, nil
+	}
+
+	if info1.Size() != info2.Size() {
+		return false, nil
+	}
+
+	return fileContentsEqual(ctx, path1, path2, true)
+}
+
+func dirsEqual(ctx context.Context, path1, path2 string, opts *CompareOptions, visit WalkDiffFunc) (bool, error) {
+	return treesEqual(ctx, osFiles, path1, osFiles, path2, opts, visit)
+}
+
+func treesEqual(
+	ctx context.Context,
+	tree1 tree,
+	path1 string,
+	tree2 tree,
+	path2 string,
+	opts *CompareOptions,
+	visit WalkDiffFunc,
+) (bool, error) {
+	c := newComparison(ctx, opts, tree1, tree2, visit)
+	return c.finish(c.dirsEqual(path1, path2, "."))
 }
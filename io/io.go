@@ -1,7 +1,10 @@
 package io
 
 import (
+	"context"
+	"errors"
 	"io"
+	"io/fs"
 )
 
 const (
@@ -13,6 +16,12 @@ const (
 )
 
 var (
+	// SkipDir is used as a return value from WalkDiffFunc to skip a directory.
+	SkipDir = fs.SkipDir
+
+	// SkipAll is used as a return value from WalkDiffFunc to stop the walk.
+	SkipAll = errors.New("skip everything and stop the walk")
+
 	ErrShortWrite    = io.ErrShortWrite
 	ErrShortBuffer   = io.ErrShortBuffer
 	EOF              = io.EOF
@@ -24,6 +33,46 @@ func Exists(path string) (bool, error) {
 	return exists(path)
 }
 
+// Lexists is the same as Exists, but does not follow symbolic links,
+// so it returns true for dangling links too.
+func Lexists(path string) (bool, error) {
+	return lexists(path)
+}
+
+// Returns true iff the path entry exists and is a symbolic link, whether its target exists or not.
+func IsSymlink(path string) (bool, error) {
+	return isSymlinkPath(path)
+}
+
+// Returns true iff the path entry is a symbolic link, whose target does not exist or is a cyclic link.
+func IsBrokenSymlink(path string) (bool, error) {
+	return isBrokenSymlink(path)
+}
+
+// ResolveSymlink follows the chain of symbolic links, starting at the path, and returns the first path,
+// which is not a link, whether it exists or not. The path itself is returned, if it is not a link.
+// Relative link targets are joined with directories of links.
+// A cyclic chain or one longer than DefaultMaxSymlinkHops results in ErrSymlinkLoop.
+func ResolveSymlink(path string) (string, error) {
+	return resolveSymlink(path, DefaultMaxSymlinkHops)
+}
+
+// ResolveSymlinkWithMaxHops is the same as ResolveSymlink, but allows to limit the number of followed links.
+// Zero or less means DefaultMaxSymlinkHops.
+func ResolveSymlinkWithMaxHops(path string, maxHops int) (string, error) {
+	return resolveSymlink(path, maxHops)
+}
+
+// Stat returns FileInfo of the path, following symbolic links.
+func Stat(path string) (*FileInfo, error) {
+	return newFileInfo(path, true)
+}
+
+// Lstat is the same as Stat, but describes symbolic links themselves, so FileInfo.IsSymlink may be true.
+func Lstat(path string) (*FileInfo, error) {
+	return newFileInfo(path, false)
+}
+
 func IsFile(path string) (bool, error) {
 	return isFileOrDir(path, false)
 }
@@ -48,10 +97,34 @@ func IsParentDir(path string) (bool, error) {
 	return isParentDir(path)
 }
 
+// Close closes all closers and returns the first error, if any. See CloseAll to get all errors.
 func Close(closers ...io.Closer) error {
 	return closeMany(closers...)
 }
 
+// CloseAll closes all closers, like Close does, but returns errors of all failed closers.
+// The result is either nil or MultiError of *CloseError, telling which closer failed.
+func CloseAll(closers ...io.Closer) error {
+	return closeAll(closers...)
+}
+
+// CloseInto closes all closers and merges their errors into the error, the pointer refers to.
+// It is meant to be deferred with a pointer to a named result:
+//
+//	func write(path string) (err error) {
+//		file, err := os.Create(path)
+//		if err != nil {
+//			return err
+//		}
+//		defer CloseInto(&err, file)
+//		...
+//	}
+//
+// If the error is already set, it comes first in the resulting MultiError.
+func CloseInto(err *error, closers ...io.Closer) {
+	*err = appendError(*err, closeAll(closers...))
+}
+
 func CloseQuietly(closers ...io.Closer) {
 	closeQuietly(closers...)
 }
@@ -67,18 +140,147 @@ func CloseOrPanic(closers ...io.Closer) {
 }
 
 func FilesEqual(path1, path2 string) (equal bool, err error) {
-	return filesEqual(path1, path2, nil)
+	return FilesEqualContext(context.Background(), path1, path2)
+}
+
+// FilesEqualContext is the same as FilesEqual, but stops and returns ctx.Err() as soon as the context is done.
+func FilesEqualContext(ctx context.Context, path1, path2 string) (equal bool, err error) {
+	return filesEqual(ctx, path1, path2)
 }
 
 func DirsEqual(path1, path2 string) (equal bool, err error) {
-	return dirsEqual(path1, path2, nil)
+	return DirsEqualWithOptions(path1, path2, CompareOptions{})
+}
+
+func DirsEqualWithOptions(path1, path2 string, opts CompareOptions) (equal bool, err error) {
+	return DirsEqualContext(context.Background(), path1, path2, opts)
+}
+
+// DirsEqualContext is the same as DirsEqualWithOptions, but stops and returns ctx.Err() as soon as the context is done.
+func DirsEqualContext(ctx context.Context, path1, path2 string, opts CompareOptions) (equal bool, err error) {
+	if err := opts.validate(); err != nil {
+		return false, err
+	}
+
+	return dirsEqual(ctx, path1, path2, &opts, nil)
 }
 
 func DiffDirs(path1, path2 string) (diffs []Diff, err error) {
-	_, err = dirsEqual(path1, path2, &diffs)
+	return DiffDirsWithOptions(path1, path2, CompareOptions{})
+}
+
+func DiffDirsWithOptions(path1, path2 string, opts CompareOptions) (diffs []Diff, err error) {
+	return DiffDirsContext(context.Background(), path1, path2, opts)
+}
+
+// DiffDirsContext is the same as DiffDirsWithOptions, but stops and returns ctx.Err() as soon as the context is done.
+func DiffDirsContext(ctx context.Context, path1, path2 string, opts CompareOptions) (diffs []Diff, err error) {
+	err = WalkDiffsContext(ctx, path1, path2, opts, func(diff Diff) error {
+		diffs = append(diffs, diff)
+		return nil
+	})
+
 	return
 }
 
+// WalkDiffFunc is called for every diff found by WalkDiffs.
+//
+// Return SkipDir to skip the remaining entries of the directory containing the diffed entry.
+// If both items of the diff are directories, i.e. their metadata differ, their subtrees are skipped instead.
+// Return SkipAll to stop the walk without an error.
+// Any other non-nil error stops the walk and is returned by WalkDiffs.
+type WalkDiffFunc func(diff Diff) error
+
+// WalkDiffs compares directories like DiffDirs, but passes found diffs to fn as soon as they are discovered,
+// instead of collecting them. The diffs are passed in the same order as DiffDirs returns them.
+func WalkDiffs(path1, path2 string, fn WalkDiffFunc) error {
+	return WalkDiffsContext(context.Background(), path1, path2, CompareOptions{}, fn)
+}
+
+// WalkDiffsContext is the same as WalkDiffs, but accepts options and
+// stops and returns ctx.Err() as soon as the context is done.
+// With more than one worker, fn is called from a separate goroutine, but never concurrently.
+func WalkDiffsContext(ctx context.Context, path1, path2 string, opts CompareOptions, fn WalkDiffFunc) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if _, err := dirsEqual(ctx, path1, path2, &opts, fn); err != nil && err != SkipAll {
+		return err
+	}
+
+	return nil
+}
+
+// FSEqual is the same as DirsEqual, but compares directories of file systems,
+// e.g. embed.FS, zip.Reader, fstest.MapFS or os.DirFS. Roots are names valid for fs.ValidPath, e.g. ".".
+func FSEqual(fsys1 fs.FS, root1 string, fsys2 fs.FS, root2 string) (equal bool, err error) {
+	return FSEqualContext(context.Background(), fsys1, root1, fsys2, root2, CompareOptions{})
+}
+
+// FSEqualContext is the same as DirsEqualContext, but compares directories of file systems.
+// File systems must be safe for concurrent use, if opts.Workers is more than one.
+// Digests of files are never cached, because the files have no absolute paths.
+// Symbolic links are compared only in file systems, which implement Lstat and ReadLink methods.
+func FSEqualContext(
+	ctx context.Context,
+	fsys1 fs.FS,
+	root1 string,
+	fsys2 fs.FS,
+	root2 string,
+	opts CompareOptions,
+) (equal bool, err error) {
+	if err := validateFSRoots(root1, root2, &opts); err != nil {
+		return false, err
+	}
+
+	return treesEqual(ctx, fsTree{fsys: fsys1}, root1, fsTree{fsys: fsys2}, root2, &opts, nil)
+}
+
+// DiffFS is the same as DiffDirs, but compares directories of file systems.
+// Full paths of diff items are names in the file systems. See FSEqualContext for details.
+func DiffFS(fsys1 fs.FS, root1 string, fsys2 fs.FS, root2 string) (diffs []Diff, err error) {
+	return DiffFSContext(context.Background(), fsys1, root1, fsys2, root2, CompareOptions{})
+}
+
+// DiffFSContext is the same as DiffDirsContext, but compares directories of file systems.
+func DiffFSContext(
+	ctx context.Context,
+	fsys1 fs.FS,
+	root1 string,
+	fsys2 fs.FS,
+	root2 string,
+	opts CompareOptions,
+) (diffs []Diff, err error) {
+	err = WalkDiffsFSContext(ctx, fsys1, root1, fsys2, root2, opts, func(diff Diff) error {
+		diffs = append(diffs, diff)
+		return nil
+	})
+
+	return
+}
+
+// WalkDiffsFSContext is the same as WalkDiffsContext, but compares directories of file systems.
+func WalkDiffsFSContext(
+	ctx context.Context,
+	fsys1 fs.FS,
+	root1 string,
+	fsys2 fs.FS,
+	root2 string,
+	opts CompareOptions,
+	fn WalkDiffFunc,
+) error {
+	if err := validateFSRoots(root1, root2, &opts); err != nil {
+		return err
+	}
+
+	if _, err := treesEqual(ctx, fsTree{fsys: fsys1}, root1, fsTree{fsys: fsys2}, root2, &opts, fn); err != nil && err != SkipAll {
+		return err
+	}
+
+	return nil
+}
+
 // ----------------------------------------------------------------------------------------------------
 
 func WriteString(w io.Writer, s string) (n int, err error) {
@@ -1,9 +1,16 @@
 package io
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
+	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -221,6 +228,276 @@ func TestDiffDirsC_DifferentContentStructure(t *testing.T) {
 	}
 }
 
+func TestDiffDirsC_KindsAndPaths(t *testing.T) {
+	diffs, err := DiffDirs(diffPath("c1"), diffPath("c2"))
+	if !assert.Nil(t, err) || !assert.Equal(t, 15, len(diffs)) {
+		t.FailNow()
+	}
+
+	expected := []struct {
+		kind DiffKind
+		path string
+	}{
+		{DiffKindRemoved, "s0"},
+		{DiffKindAdded, "s1/S2"},
+		{DiffKindContentChanged, "s1/s1/0.bin"},
+		{DiffKindRemoved, "s1/s2"},
+		{DiffKindAdded, "s2"},
+		{DiffKindRemoved, "s3"},
+		{DiffKindAdded, "s4"},
+		{DiffKindAdded, "s5/aa"},
+		{DiffKindRemoved, "s5/s0/0.bin"},
+		{DiffKindAdded, "s5/s0/1.bin"},
+		{DiffKindContentChanged, "s5/s2/0.bin"},
+		{DiffKindAdded, "s5/s2/1.bin"},
+		{DiffKindTypeChanged, "s5/s3/0.bin"},
+		{DiffKindAdded, "s5/zz"},
+		{DiffKindAdded, "s6"},
+	}
+
+	for i, diff := range diffs {
+		assert.Equal(t, expected[i].kind, diff.Kind, "diff %d", i)
+		assert.Equal(t, expected[i].path, diff.Path, "diff %d", i)
+	}
+}
+
+func TestDiffDirsWithOptionsC_Exclude(t *testing.T) {
+	diffs, err := DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{
+		Exclude:        []string{"s5"},
+		ExcludeRegexps: []*regexp.Regexp{regexp.MustCompile(`^s1/s[12]$`)},
+	})
+
+	if assert.Nil(t, err) && assert.Equal(t, 6, len(diffs)) {
+		for i, path := range []string{"s0", "s1/S2", "s2", "s3", "s4", "s6"} {
+			assert.Equal(t, path, diffs[i].Path)
+		}
+	}
+}
+
+func TestDiffDirsWithOptionsC_Include(t *testing.T) {
+	diffs, err := DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{
+		Include: []string{"s5/s2/*.bin"},
+	})
+
+	// Directories without included entries, e.g. the directory s5/s3/0.bin, are ignored.
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(diffs)) {
+		assert.Equal(t, "s5/s2/0.bin", diffs[0].Path)
+		assert.Equal(t, DiffKindContentChanged, diffs[0].Kind)
+		assert.Equal(t, "s5/s2/1.bin", diffs[1].Path)
+		assert.Equal(t, DiffKindAdded, diffs[1].Kind)
+	}
+
+	diffs, err = DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{
+		Include: []string{"*.bin"},
+	})
+
+	// The included file s5/s3/0.bin is replaced with a directory without included entries.
+	if assert.Nil(t, err) && assert.Equal(t, 6, len(diffs)) {
+		for i, path := range []string{"s1/s1/0.bin", "s5/s0/0.bin", "s5/s0/1.bin", "s5/s2/0.bin", "s5/s2/1.bin"} {
+			assert.Equal(t, path, diffs[i].Path)
+		}
+
+		assert.Equal(t, "s5/s3/0.bin", diffs[5].Path)
+		assert.Equal(t, DiffKindTypeChanged, diffs[5].Kind)
+	}
+}
+
+func TestDiffDirsWithOptionsC_MaxDepth(t *testing.T) {
+	diffs, err := DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{MaxDepth: 1})
+
+	if assert.Nil(t, err) && assert.Equal(t, 5, len(diffs)) {
+		for i, path := range []string{"s0", "s2", "s3", "s4", "s6"} {
+			assert.Equal(t, path, diffs[i].Path)
+		}
+	}
+}
+
+func TestDirsEqualWithOptions_Hidden(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(dir1, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir2, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir2, ".git", "HEAD"), "ref")
+
+	equal, err := DirsEqualWithOptions(dir1, dir2, CompareOptions{})
+	assert.Nil(t, err)
+	assert.False(t, equal)
+
+	equal, err = DirsEqualWithOptions(dir1, dir2, CompareOptions{Hidden: HiddenExclude})
+	assert.Nil(t, err)
+	assert.True(t, equal)
+}
+
+func TestDiffDirsWithOptions_NoFollowSymlinks(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(dir1, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir2, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir2, "b.txt"), "a")
+
+	if err := os.Symlink("a.txt", filepath.Join(dir1, "link")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	if err := os.Symlink("b.txt", filepath.Join(dir2, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := DiffDirsWithOptions(dir1, dir2, CompareOptions{Exclude: []string{"b.txt"}})
+	assert.Nil(t, err)
+	assert.Zero(t, len(diffs))
+
+	diffs, err = DiffDirsWithOptions(dir1, dir2, CompareOptions{Exclude: []string{"b.txt"}, NoFollowSymlinks: true})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(diffs)) {
+		assert.Equal(t, "link", diffs[0].Path)
+		assert.Equal(t, DiffKindContentChanged, diffs[0].Kind)
+		assert.Equal(t, DiffReasonSymlinkTarget, diffs[0].Reasons)
+		assert.True(t, diffs[0].Item1.IsSymlink())
+	}
+}
+
+func TestDiffDirsWithOptions_Metadata(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(dir1, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir2, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dir1, "b.txt"), "b")
+	writeTestFile(t, filepath.Join(dir2, "b.txt"), "c")
+
+	modTime := time.Date(2023, 1, 9, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{filepath.Join(dir1, "a.txt"), filepath.Join(dir1, "b.txt")} {
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{filepath.Join(dir2, "a.txt"), filepath.Join(dir2, "b.txt")} {
+		if err := os.Chtimes(name, modTime, modTime.Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Chmod(filepath.Join(dir2, "b.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := DiffDirsWithOptions(dir1, dir2, CompareOptions{ComparePermissions: true, CompareModTime: true})
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(diffs)) {
+		assert.Equal(t, "a.txt", diffs[0].Path)
+		assert.Equal(t, DiffKindMetadataChanged, diffs[0].Kind)
+		assert.Equal(t, DiffReasonModTime, diffs[0].Reasons)
+
+		assert.Equal(t, "b.txt", diffs[1].Path)
+		assert.Equal(t, DiffKindContentChanged, diffs[1].Kind)
+		assert.True(t, diffs[1].Reasons.Has(DiffReasonModTime))
+		if runtime.GOOS != "windows" {
+			assert.True(t, diffs[1].Reasons.Has(DiffReasonPermissions))
+		}
+	}
+
+	equal, err := DirsEqualWithOptions(dir1, dir2, CompareOptions{
+		CompareModTime:   true,
+		ModTimeTolerance: time.Second,
+		Exclude:          []string{"b.txt"},
+	})
+	assert.Nil(t, err)
+	assert.True(t, equal)
+}
+
+func TestDirsEqualWithOptions_BadPattern(t *testing.T) {
+	_, err := DirsEqualWithOptions(diffPath("a1"), diffPath("a2"), CompareOptions{Exclude: []string{"["}})
+	assert.ErrorIs(t, err, path.ErrBadPattern)
+}
+
+func TestDiffDirsWithOptionsC_Workers(t *testing.T) {
+	expected, err := DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	for _, workers := range []int{2, 3, 8} {
+		diffs, err := DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{Workers: workers})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, diffs, "workers %d", workers)
+	}
+}
+
+func TestDirsEqualWithOptions_Workers(t *testing.T) {
+	for _, test := range []struct {
+		dir1, dir2 string
+		equal      bool
+	}{
+		{"a1", "a2", true},
+		{"b1", "b2", false},
+		{"c1", "c2", false},
+	} {
+		equal, err := DirsEqualWithOptions(diffPath(test.dir1), diffPath(test.dir2), CompareOptions{Workers: 4})
+		assert.Nil(t, err)
+		assert.Equal(t, test.equal, equal, "%s vs %s", test.dir1, test.dir2)
+	}
+}
+
+func TestFilesEqualContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := FilesEqualContext(ctx, diffPath("a1/0.bin"), diffPath("a2/0.bin"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDirsEqualContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, workers := range []int{0, 4} {
+		_, err := DirsEqualContext(ctx, diffPath("a1"), diffPath("a2"), CompareOptions{Workers: workers})
+		assert.ErrorIs(t, err, context.Canceled, "workers %d", workers)
+
+		_, err = DiffDirsContext(ctx, diffPath("c1"), diffPath("c2"), CompareOptions{Workers: workers})
+		assert.ErrorIs(t, err, context.Canceled, "workers %d", workers)
+	}
+}
+
+func TestWalkDiffsC_SkipDir(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		var paths []string
+
+		err := WalkDiffsContext(context.Background(), diffPath("c1"), diffPath("c2"), CompareOptions{Workers: workers},
+			func(diff Diff) error {
+				paths = append(paths, diff.Path)
+				if diff.Path == "s1/S2" || diff.Path == "s5/aa" {
+					return SkipDir
+				}
+				return nil
+			},
+		)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"s0", "s1/S2", "s2", "s3", "s4", "s5/aa", "s6"}, paths, "workers %d", workers)
+	}
+}
+
+func TestWalkDiffsC_Stop(t *testing.T) {
+	var count int
+
+	err := WalkDiffs(diffPath("c1"), diffPath("c2"), func(diff Diff) error {
+		count++
+		if diff.Path == "s1/s1/0.bin" {
+			return SkipAll
+		}
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	errStop := errors.New("stop")
+	count = 0
+
+	err = WalkDiffs(diffPath("c1"), diffPath("c2"), func(diff Diff) error {
+		count++
+		return errStop
+	})
+
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, count)
+}
+
 func testPath() string {
 	for _, path := range []string{"./io/testdata", "./testdata"} {
 		if ok, err := IsDir(path); err != nil {
@@ -236,3 +513,15 @@ func testPath() string {
 func diffPath(path string) string {
 	return filepath.Join(testPath(), "diffs", path)
 }
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
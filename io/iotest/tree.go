@@ -0,0 +1,221 @@
+// Package iotest builds directory trees for tests from declarative specs and checks directories against them.
+package iotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/SladeThe/common-go/io"
+)
+
+// Entry describes a regular file, a directory or a symbolic link of a tree.
+type Entry struct {
+	// Contents of a regular file.
+	Content string
+
+	// Target of a symbolic link, which is written as is, so it is usually relative and slash-separated.
+	// The entry is a link, if the target is not empty.
+	Symlink string
+
+	// Set this to true to describe a directory, e.g. an empty one. Parents of other entries are implied.
+	Dir bool
+
+	// Permissions of the entry, which are ignored for symbolic links.
+	// Zero means 0644 for files and 0755 for directories, and such permissions are not checked by AssertTree.
+	Mode os.FileMode
+}
+
+// File describes a regular file with the contents.
+func File(content string) Entry {
+	return Entry{Content: content}
+}
+
+// Dir describes a directory.
+func Dir() Entry {
+	return Entry{Dir: true}
+}
+
+// Symlink describes a symbolic link to the target.
+func Symlink(target string) Entry {
+	return Entry{Symlink: target}
+}
+
+// WithMode returns the entry with the permissions.
+func (e Entry) WithMode(mode os.FileMode) Entry {
+	e.Mode = mode
+	return e
+}
+
+func (e Entry) validate() error {
+	switch {
+	case e.Dir && (e.Content != "" || e.Symlink != ""):
+		return errors.New("directory has contents or a target")
+	case e.Symlink != "" && (e.Content != "" || e.Mode != 0):
+		return errors.New("symbolic link has contents or permissions")
+	default:
+		return nil
+	}
+}
+
+func (e Entry) perm() os.FileMode {
+	switch {
+	case e.Mode != 0:
+		return e.Mode.Perm()
+	case e.Dir:
+		return 0755
+	default:
+		return 0644
+	}
+}
+
+// Tree maps slash-separated paths relative to the tree root to entries, e.g.
+//
+//	iotest.Tree{
+//		"a/0.txt": iotest.File("0"),
+//		"a/run.sh": iotest.File("#!/bin/sh").WithMode(0755),
+//		"empty": iotest.Dir(),
+//		"link": iotest.Symlink("a/0.txt"),
+//	}
+type Tree map[string]Entry
+
+// Returns names in the order of writing, i.e. parents first.
+func (tree Tree) names() ([]string, error) {
+	names := make([]string, 0, len(tree))
+
+	for name, entry := range tree {
+		if !fs.ValidPath(name) || name == "." {
+			return nil, &io.PathError{Op: "tree", Path: name, Err: fs.ErrInvalid}
+		}
+
+		if err := entry.validate(); err != nil {
+			return nil, &io.PathError{Op: "tree", Path: name, Err: err}
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// WriteTree creates entries of the tree in the existing directory together with implied parent directories.
+// Permissions of directories are applied in the end, so read-only directories are filled too.
+func WriteTree(dir string, tree Tree) error {
+	names, err := tree.names()
+	if err != nil {
+		return err
+	}
+
+	var dirs []string
+
+	for _, name := range names {
+		entry := tree[name]
+		entryPath := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+			return err
+		}
+
+		switch {
+		case entry.Dir:
+			if err := os.Mkdir(entryPath, 0755); err != nil && !os.IsExist(err) {
+				return err
+			}
+
+			dirs = append(dirs, name)
+		case entry.Symlink != "":
+			if err := os.Symlink(entry.Symlink, entryPath); err != nil {
+				return err
+			}
+		default:
+			if err := os.WriteFile(entryPath, []byte(entry.Content), 0600); err != nil {
+				return err
+			}
+
+			if err := os.Chmod(entryPath, entry.perm()); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Children first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(filepath.Join(dir, filepath.FromSlash(dirs[i])), tree[dirs[i]].perm()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BuildTree creates the tree in a new temporary directory, which is removed, when the test finishes,
+// and returns the directory path. The test fails immediately, if the tree cannot be created.
+func BuildTree(t testing.TB, tree Tree) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	if err := WriteTree(dir, tree); err != nil {
+		t.Fatalf("cannot build tree: %v", err)
+	}
+
+	return dir
+}
+
+// AssertTree checks the directory contains exactly the tree, comparing it with the tree built by BuildTree.
+// Symbolic links are compared by targets, and permissions are compared only for entries with explicit modes.
+// Otherwise, the test is marked as failed with a summary of diffs, where added entries are unexpected ones.
+// It returns true iff the directory matches the tree.
+func AssertTree(t testing.TB, dir string, tree Tree) bool {
+	t.Helper()
+
+	expected := BuildTree(t, tree)
+
+	diffs, err := io.DiffDirsContext(context.Background(), expected, dir, io.CompareOptions{NoFollowSymlinks: true})
+	if err != nil {
+		t.Errorf("cannot compare %s with the expected tree: %v", dir, err)
+		return false
+	}
+
+	var mismatches []string
+
+	for name, entry := range tree {
+		if entry.Mode == 0 || entry.Symlink != "" {
+			continue
+		}
+
+		info, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			// Reported as a diff.
+			continue
+		}
+
+		if perm := info.Mode().Perm(); perm != entry.Mode.Perm() {
+			mismatches = append(mismatches, fmt.Sprintf("%s has permissions %v instead of %v", name, perm, entry.Mode.Perm()))
+		}
+	}
+
+	if len(diffs) == 0 && len(mismatches) == 0 {
+		return true
+	}
+
+	var summary strings.Builder
+	if len(diffs) > 0 {
+		_ = io.WriteSummary(&summary, diffs)
+	}
+
+	sort.Strings(mismatches)
+	for _, mismatch := range mismatches {
+		summary.WriteString(mismatch + "\n")
+	}
+
+	t.Errorf("%s differs from the expected tree:\n%s", dir, summary.String())
+	return false
+}
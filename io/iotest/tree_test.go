@@ -0,0 +1,92 @@
+package iotest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT records errors instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+var testTree = Tree{
+	"a/0.txt":     File("0"),
+	"a/b/run.sh":  File("#!/bin/sh\n").WithMode(0750),
+	"empty":       Dir(),
+	"private":     Dir().WithMode(0700),
+	"link":        Symlink("a/0.txt"),
+	"a/empty.txt": File(""),
+}
+
+func TestBuildTree(t *testing.T) {
+	dir := BuildTree(t, testTree)
+
+	content, err := os.ReadFile(filepath.Join(dir, "a", "0.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "0", string(content))
+
+	info, err := os.Stat(filepath.Join(dir, "a", "b", "run.sh"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0750), info.Mode())
+	}
+
+	info, err = os.Stat(filepath.Join(dir, "private"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.ModeDir|0700, info.Mode())
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "empty"))
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	target, err := os.Readlink(filepath.Join(dir, "link"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a/0.txt", target)
+
+	assert.True(t, AssertTree(t, dir, testTree))
+}
+
+func TestAssertTree_Mismatch(t *testing.T) {
+	dir := BuildTree(t, testTree)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "a", "0.txt"), []byte("changed"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "unexpected.txt"), nil, 0644))
+	assert.Nil(t, os.Remove(filepath.Join(dir, "empty")))
+	assert.Nil(t, os.Chmod(filepath.Join(dir, "a", "b", "run.sh"), 0755))
+
+	recorder := &recordingT{TB: t}
+	assert.False(t, AssertTree(recorder, dir, testTree))
+
+	if assert.Equal(t, 1, len(recorder.errors)) {
+		assert.Equal(t, dir+" differs from the expected tree:\n"+
+			"M  a/0.txt\n"+
+			"D  empty/\n"+
+			"A  unexpected.txt\n"+
+			"\n"+
+			"1 added, 1 removed, 1 content changed\n"+
+			"a/b/run.sh has permissions -rwxr-xr-x instead of -rwxr-x---\n", recorder.errors[0])
+	}
+}
+
+func TestWriteTree_Invalid(t *testing.T) {
+	for _, tree := range []Tree{
+		{"../a": File("")},
+		{"/a": File("")},
+		{".": Dir()},
+		{"a": Entry{Dir: true, Content: "a"}},
+		{"a": Entry{Symlink: "b", Mode: 0644}},
+		{"a": File(""), "a/b": File("")},
+	} {
+		assert.NotNil(t, WriteTree(t.TempDir(), tree), fmt.Sprint(tree))
+	}
+}
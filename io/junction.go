@@ -1,8 +1,9 @@
 package io
 
 import (
-	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 )
@@ -20,25 +21,95 @@ var junctionImpl = func() func(directory, junction string) error {
 		}
 	}
 
-	// TODO see os_windows_test.go: createMountPoint for more impl options
+	if runtime.GOOS == "linux" {
+		// Linux has no junctions, so an absolute directory symlink is the closest equivalent:
+		// it keeps pointing to the same directory, wherever the link is moved.
+		return func(directory, junction string) error {
+			abs, err := filepath.Abs(directory)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(abs, junction)
+		}
+	}
 
 	return func(directory, junction string) error {
-		return fmt.Errorf("junctions are not supported on this OS/ARCH")
+		return &PathError{Op: "junction", Path: junction, Err: ErrUnsupported}
 	}
 }()
 
+// Junction creates a junction to the directory, i.e. "mklink /J" on Windows or an absolute symlink on Linux.
+// ErrUnsupported is returned on other systems.
 func Junction(directory, junction string) error {
 	if isDir, err := IsDir(directory); err != nil {
 		return err
 	} else if !isDir {
-		return fmt.Errorf("not a directory: %s", directory)
+		return errNotDir("junction", directory)
 	}
 
-	if exists, err := Exists(junction); err != nil {
+	// Dangling symbolic links exist too.
+	if exists, err := Lexists(junction); err != nil {
 		return err
 	} else if exists {
-		return fmt.Errorf("must not exist: %s", junction)
+		return errExist("junction", junction)
 	}
 
 	return junctionImpl(directory, junction)
 }
+
+// Returns true iff the path is a junction or a link created by Junction,
+// i.e. a link with an absolute target, which is a directory or does not exist anymore.
+// Links created by Junction on Linux are ordinary symbolic links,
+// so any absolute symbolic link to a directory is reported as a junction there.
+func IsJunction(path string) (bool, error) {
+	_, ok, err := readJunction(path)
+	return ok, err
+}
+
+// ReadJunction returns the absolute path of the directory, the junction points to.
+// ErrNotJunction is returned, if the path is not a junction according to IsJunction.
+func ReadJunction(path string) (string, error) {
+	target, ok, err := readJunction(path)
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", &PathError{Op: "readjunction", Path: path, Err: ErrNotJunction}
+	}
+
+	return target, nil
+}
+
+func readJunction(path string) (target string, ok bool, err error) {
+	if len(path) <= 0 {
+		return "", false, ErrEmptyPath
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	// Depending on the Go version, Windows junctions are reported either as symlinks or as irregular files.
+	if !isSymlink(info) && info.Mode()&os.ModeIrregular == 0 {
+		return "", false, nil
+	}
+
+	if target, err = os.Readlink(path); err != nil {
+		return "", false, err
+	}
+
+	if !filepath.IsAbs(target) {
+		return "", false, nil
+	}
+
+	if targetInfo, err := os.Stat(target); err == nil {
+		return target, isDir(targetInfo), nil
+	} else if !os.IsNotExist(err) {
+		return "", false, err
+	}
+
+	return target, true, nil
+}
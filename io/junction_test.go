@@ -0,0 +1,72 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJunction(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		t.Skip("junctions are not supported on " + runtime.GOOS)
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	junction := filepath.Join(dir, "junction")
+	writeTestFile(t, filepath.Join(target, "a.txt"), "a")
+
+	if err := Junction(target, junction); err != nil {
+		t.Skip(err)
+	}
+
+	assertFileContent(t, filepath.Join(junction, "a.txt"), "a")
+
+	isJunction, err := IsJunction(junction)
+	assert.Nil(t, err)
+	assert.True(t, isJunction)
+
+	resolved, err := ReadJunction(junction)
+	if assert.Nil(t, err) {
+		abs, err := filepath.Abs(target)
+		assert.Nil(t, err)
+		assert.Equal(t, abs, resolved)
+	}
+
+	for _, path := range []string{target, filepath.Join(target, "a.txt"), filepath.Join(dir, "missing")} {
+		isJunction, err := IsJunction(path)
+		assert.Nil(t, err, path)
+		assert.False(t, isJunction, path)
+
+		_, err = ReadJunction(path)
+		assert.ErrorIs(t, err, ErrNotJunction, path)
+	}
+
+	assert.True(t, os.IsExist(Junction(target, junction)))
+
+	// A dangling link is an existing entry too.
+	dangling := filepath.Join(dir, "dangling")
+	if err := os.Symlink(filepath.Join(dir, "missing"), dangling); err == nil {
+		assert.True(t, os.IsExist(Junction(target, dangling)))
+	}
+}
+
+func TestIsJunction_RelativeSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "target", "a.txt"), "a")
+	assert.Nil(t, os.Symlink("target", filepath.Join(dir, "relative")))
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "target", "a.txt"), filepath.Join(dir, "file")))
+
+	for _, name := range []string{"relative", "file"} {
+		isJunction, err := IsJunction(filepath.Join(dir, name))
+		assert.Nil(t, err, name)
+		assert.False(t, isJunction, name)
+	}
+}
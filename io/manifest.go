@@ -0,0 +1,542 @@
+package io
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const manifestTextHeader = "# manifest v1"
+
+// EntryType is a coarse type of a tree entry.
+type EntryType string
+
+const (
+	EntryTypeFile    EntryType = "file"
+	EntryTypeDir     EntryType = "dir"
+	EntryTypeSymlink EntryType = "symlink"
+	// EntryTypeOther covers devices, named pipes, sockets and so on.
+	EntryTypeOther EntryType = "other"
+)
+
+func entryType(info os.FileInfo) EntryType {
+	switch {
+	case isFile(info):
+		return EntryTypeFile
+	case isDir(info):
+		return EntryTypeDir
+	case isSymlink(info):
+		return EntryTypeSymlink
+	default:
+		return EntryTypeOther
+	}
+}
+
+// ManifestEntry describes a single entry of a directory tree.
+type ManifestEntry struct {
+	// Slash-separated path relative to the manifest root.
+	Path    string      `json:"path"`
+	Type    EntryType   `json:"type"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+
+	// Hex-encoded digest of a regular file, empty for other types.
+	Digest string `json:"digest,omitempty"`
+
+	// Target of a symbolic link, empty for other types.
+	Target string `json:"target,omitempty"`
+}
+
+// Manifest is a snapshot of a directory tree, which can be stored and later compared against the tree.
+type Manifest struct {
+	// Directory, the manifest was captured from.
+	Root      string          `json:"root"`
+	Algorithm DigestAlgorithm `json:"algorithm"`
+
+	// Entries in the traversal order, i.e. the same order DiffDirs uses.
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// CaptureManifest records every entry of the directory tree using SHA-256 digests.
+func CaptureManifest(dir string) (*Manifest, error) {
+	return CaptureManifestWithOptions(dir, CompareOptions{})
+}
+
+// CaptureManifestWithOptions records entries of the directory tree accepted by the options.
+// Digests are computed with opts.Digest, where DigestNone means DigestSHA256.
+// Options, which control the comparison itself, e.g. Workers, are ignored.
+func CaptureManifestWithOptions(dir string, opts CompareOptions) (*Manifest, error) {
+	return captureManifest(context.Background(), dir, &opts)
+}
+
+// ReadManifestJSON reads a manifest written by Manifest.WriteJSON.
+func ReadManifestJSON(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// WriteJSON writes the manifest as a single JSON object.
+func (m *Manifest) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(m)
+}
+
+// ReadManifestText reads a manifest written by Manifest.WriteText.
+func ReadManifestText(r io.Reader) (*Manifest, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, bufferSize)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("manifest is empty")
+	}
+
+	m, err := parseManifestTextHeader(scanner.Text())
+	if err != nil {
+		return nil, err
+	}
+
+	for lineNumber := 2; scanner.Scan(); lineNumber++ {
+		entry, err := parseManifestTextEntry(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest line %d: %w", lineNumber, err)
+		}
+
+		m.Entries = append(m.Entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// WriteText writes the manifest in a line-based format, which is convenient to review and to diff:
+//
+//	# manifest v1 sha256 "/srv/release"
+//	dir 20000000755 4096 2023-01-09T12:00:00Z - "bin"
+//	file 644 2560000 2023-01-09T12:00:00Z 5f70bf18... "bin/0.bin"
+//	symlink 1000000777 5 2023-01-09T12:00:00Z - "latest" "0.bin"
+//
+// Fields are the type, octal mode, size, mtime, digest and quoted path, followed by the quoted target for symlinks.
+func (m *Manifest) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	if _, err := fmt.Fprintf(bw, "%s %v %s\n", manifestTextHeader, m.Algorithm, strconv.Quote(m.Root)); err != nil {
+		return err
+	}
+
+	for _, entry := range m.Entries {
+		digest := entry.Digest
+		if digest == "" {
+			digest = "-"
+		}
+
+		if _, err := fmt.Fprintf(bw, "%s %o %d %s %s %s",
+			entry.Type, uint32(entry.Mode), entry.Size, entry.ModTime.UTC().Format(time.RFC3339Nano),
+			digest, strconv.Quote(entry.Path),
+		); err != nil {
+			return err
+		}
+
+		if entry.Type == EntryTypeSymlink {
+			if _, err := fmt.Fprintf(bw, " %s", strconv.Quote(entry.Target)); err != nil {
+				return err
+			}
+		}
+
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// DiffManifest compares the manifest against the current state of the directory.
+// The manifest is the first tree, so entries created since the capture are reported as added.
+func DiffManifest(manifest *Manifest, dir string) ([]Diff, error) {
+	return DiffManifestWithOptions(manifest, dir, CompareOptions{})
+}
+
+// DiffManifestWithOptions is the same as DiffManifest, but the directory is captured with the options.
+// The options should be the same as the ones the manifest was captured with, except for the digest algorithm,
+// which is always taken from the manifest.
+func DiffManifestWithOptions(manifest *Manifest, dir string, opts CompareOptions) ([]Diff, error) {
+	opts.Digest = manifest.Algorithm
+
+	live, err := captureManifest(context.Background(), dir, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffManifests(manifest, live, &opts)
+}
+
+// DiffManifests compares two manifests captured with the same digest algorithm.
+// Entries are compared by type, size, digest and symlink target.
+func DiffManifests(m1, m2 *Manifest) ([]Diff, error) {
+	return DiffManifestsWithOptions(m1, m2, CompareOptions{})
+}
+
+// DiffManifestsWithOptions is the same as DiffManifests,
+// but also compares permissions and modification times, if the options say so.
+// Filtering options and ownership comparison are ignored.
+func DiffManifestsWithOptions(m1, m2 *Manifest, opts CompareOptions) ([]Diff, error) {
+	return diffManifests(m1, m2, &opts)
+}
+
+func parseManifestTextHeader(line string) (*Manifest, error) {
+	if !strings.HasPrefix(line, manifestTextHeader+" ") {
+		return nil, fmt.Errorf("invalid manifest header: %s", line)
+	}
+
+	fields := strings.SplitN(strings.TrimPrefix(line, manifestTextHeader+" "), " ", 2)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("invalid manifest header: %s", line)
+	}
+
+	m := &Manifest{}
+
+	if err := m.Algorithm.UnmarshalText([]byte(fields[0])); err != nil {
+		return nil, err
+	}
+
+	root, err := strconv.Unquote(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest root: %w", err)
+	}
+
+	m.Root = root
+	return m, nil
+}
+
+func parseManifestTextEntry(line string) (ManifestEntry, error) {
+	var entry ManifestEntry
+
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) != 6 {
+		return entry, fmt.Errorf("expected at least 6 fields")
+	}
+
+	entry.Type = EntryType(fields[0])
+
+	mode, err := strconv.ParseUint(fields[1], 8, 32)
+	if err != nil {
+		return entry, err
+	}
+	entry.Mode = os.FileMode(mode)
+
+	if entry.Size, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return entry, err
+	}
+
+	if entry.ModTime, err = time.Parse(time.RFC3339Nano, fields[3]); err != nil {
+		return entry, err
+	}
+
+	if fields[4] != "-" {
+		entry.Digest = fields[4]
+	}
+
+	quotedPath, err := strconv.QuotedPrefix(fields[5])
+	if err != nil {
+		return entry, err
+	}
+
+	if entry.Path, err = strconv.Unquote(quotedPath); err != nil {
+		return entry, err
+	}
+
+	if rest := fields[5][len(quotedPath):]; entry.Type == EntryTypeSymlink {
+		if !strings.HasPrefix(rest, " ") {
+			return entry, fmt.Errorf("symlink target is missing")
+		}
+
+		if entry.Target, err = strconv.Unquote(rest[1:]); err != nil {
+			return entry, err
+		}
+	} else if rest != "" {
+		return entry, fmt.Errorf("unexpected trailing data: %s", rest)
+	}
+
+	return entry, nil
+}
+
+func captureManifest(ctx context.Context, dir string, opts *CompareOptions) (*Manifest, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := checkFileOrDir("manifest", dir, true); err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Root: dir, Algorithm: opts.Digest}
+	if m.Algorithm == DigestNone {
+		m.Algorithm = DigestSHA256
+	}
+
+	if err := m.captureDir(ctx, dir, ".", opts, make(map[inodeKey]bool), make(includedDirs)); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Captures entries of the directory. Ancestors are the directories being captured,
+// so a followed symbolic link to any of them results in ErrSymlinkLoop instead of endless recursion.
+// Included memoises directory filtering for the whole capture, see hasIncluded.
+func (m *Manifest) captureDir(
+	ctx context.Context,
+	dirPath, rel string,
+	opts *CompareOptions,
+	ancestors map[inodeKey]bool,
+	included includedDirs,
+) error {
+	if opts.tooDeep(rel) {
+		return nil
+	}
+
+	if info, err := os.Stat(dirPath); err != nil {
+		return err
+	} else if dev, ino, _, ok := fileInode(info); ok {
+		key := inodeKey{dev: dev, ino: ino}
+		if ancestors[key] {
+			return &PathError{Op: "manifest", Path: dirPath, Err: ErrSymlinkLoop}
+		}
+
+		ancestors[key] = true
+		defer delete(ancestors, key)
+	}
+
+	infos, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range opts.filter(osFiles, dirPath, rel, infos, included) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		itemPath := filepath.Join(dirPath, info.Name())
+		itemRel := relativePath(rel, info.Name())
+
+		// Dangling links are captured as links.
+		if info, err = opts.statOrLink(itemPath); err != nil {
+			return err
+		}
+
+		entry := ManifestEntry{
+			Path:    itemRel,
+			Type:    entryType(info),
+			Size:    info.Size(),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+
+		switch entry.Type {
+		case EntryTypeFile:
+			digest, err := fileDigest(ctx, itemPath, info, m.Algorithm, opts.DigestCache)
+			if err != nil {
+				return err
+			}
+
+			entry.Digest = hex.EncodeToString(digest)
+		case EntryTypeSymlink:
+			if entry.Target, err = os.Readlink(itemPath); err != nil {
+				return err
+			}
+		}
+
+		m.Entries = append(m.Entries, entry)
+
+		if entry.Type == EntryTypeDir {
+			if err := m.captureDir(ctx, itemPath, itemRel, opts, ancestors, included); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Manifest) fileInfo(entry *ManifestEntry) *FileInfo {
+	return &FileInfo{
+		FullPath: filepath.Join(m.Root, filepath.FromSlash(entry.Path)),
+		FileInfo: manifestFileInfo{entry: entry, algorithm: m.Algorithm},
+	}
+}
+
+var _ os.FileInfo = manifestFileInfo{}
+
+// manifestFileInfo adapts a manifest entry to os.FileInfo, so it can be reported through Diff.
+type manifestFileInfo struct {
+	entry     *ManifestEntry
+	algorithm DigestAlgorithm
+}
+
+func (fi manifestFileInfo) Name() string {
+	return path.Base(fi.entry.Path)
+}
+
+func (fi manifestFileInfo) Size() int64 {
+	return fi.entry.Size
+}
+
+func (fi manifestFileInfo) Mode() os.FileMode {
+	return fi.entry.Mode
+}
+
+func (fi manifestFileInfo) ModTime() time.Time {
+	return fi.entry.ModTime
+}
+
+func (fi manifestFileInfo) IsDir() bool {
+	return fi.entry.Type == EntryTypeDir
+}
+
+func (fi manifestFileInfo) Sys() interface{} {
+	return fi.entry
+}
+
+// Compares slash-separated relative paths in the traversal order, i.e. segment by segment.
+// For example, "a/b" < "a.txt", because the directory "a" precedes the file "a.txt".
+func compareRelativePaths(rel1, rel2 string) int {
+	for {
+		segment1, rest1, more1 := cutPath(rel1)
+		segment2, rest2, more2 := cutPath(rel2)
+
+		if segment1 != segment2 {
+			if segment1 < segment2 {
+				return -1
+			}
+			return 1
+		}
+
+		if !more1 || !more2 {
+			if more1 == more2 {
+				return 0
+			} else if more2 {
+				return -1
+			}
+			return 1
+		}
+
+		rel1, rel2 = rest1, rest2
+	}
+}
+
+func cutPath(rel string) (segment, rest string, more bool) {
+	if i := strings.IndexByte(rel, '/'); i >= 0 {
+		return rel[:i], rel[i+1:], true
+	}
+
+	return rel, "", false
+}
+
+func isWithin(rel, dirRel string) bool {
+	return strings.HasPrefix(rel, dirRel+"/")
+}
+
+func diffManifests(m1, m2 *Manifest, opts *CompareOptions) ([]Diff, error) {
+	if m1.Algorithm != m2.Algorithm {
+		return nil, fmt.Errorf("manifest digest algorithms differ: %v and %v", m1.Algorithm, m2.Algorithm)
+	}
+
+	var diffs []Diff
+	var pos1, pos2 int
+
+	// Skips descendants of the directory, which was reported as a whole.
+	skip := func(entries []ManifestEntry, pos int, dirRel string) int {
+		for pos < len(entries) && isWithin(entries[pos].Path, dirRel) {
+			pos++
+		}
+		return pos
+	}
+
+	for pos1 < len(m1.Entries) || pos2 < len(m2.Entries) {
+		var cmp int
+		switch {
+		case pos1 >= len(m1.Entries):
+			cmp = 1
+		case pos2 >= len(m2.Entries):
+			cmp = -1
+		default:
+			cmp = compareRelativePaths(m1.Entries[pos1].Path, m2.Entries[pos2].Path)
+		}
+
+		if cmp < 0 {
+			entry1 := &m1.Entries[pos1]
+			diffs = append(diffs, Diff{Kind: DiffKindRemoved, Path: entry1.Path, Item1: m1.fileInfo(entry1)})
+			pos1 = skip(m1.Entries, pos1+1, entry1.Path)
+			continue
+		}
+
+		if cmp > 0 {
+			entry2 := &m2.Entries[pos2]
+			diffs = append(diffs, Diff{Kind: DiffKindAdded, Path: entry2.Path, Item2: m2.fileInfo(entry2)})
+			pos2 = skip(m2.Entries, pos2+1, entry2.Path)
+			continue
+		}
+
+		entry1, entry2 := &m1.Entries[pos1], &m2.Entries[pos2]
+		pos1++
+		pos2++
+
+		diff := Diff{Path: entry1.Path, Item1: m1.fileInfo(entry1), Item2: m2.fileInfo(entry2)}
+
+		if entry1.Type != entry2.Type || entry1.Mode.Type() != entry2.Mode.Type() {
+			diff.Kind = DiffKindTypeChanged
+			diffs = append(diffs, diff)
+			pos1 = skip(m1.Entries, pos1, entry1.Path)
+			pos2 = skip(m2.Entries, pos2, entry2.Path)
+			continue
+		}
+
+		diff.Reasons = opts.metadataReasons(diff.Item1, diff.Item2)
+
+		switch entry1.Type {
+		case EntryTypeFile:
+			if entry1.Size != entry2.Size || entry1.Digest != entry2.Digest {
+				diff.Kind = DiffKindContentChanged
+			}
+		case EntryTypeSymlink:
+			if entry1.Target != entry2.Target {
+				diff.Kind = DiffKindContentChanged
+				diff.Reasons |= DiffReasonSymlinkTarget
+			}
+		}
+
+		if diff.Kind == 0 && diff.Reasons != 0 {
+			diff.Kind = DiffKindMetadataChanged
+		}
+
+		if diff.Kind != 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs, nil
+}
@@ -0,0 +1,143 @@
+package io
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffManifestC_SameAsDiffDirs(t *testing.T) {
+	expected, err := DiffDirs(diffPath("c1"), diffPath("c2"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	manifest, err := CaptureManifest(diffPath("c1"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	diffs, err := DiffManifest(manifest, diffPath("c2"))
+	if assert.Nil(t, err) && assert.Equal(t, len(expected), len(diffs)) {
+		for i, diff := range diffs {
+			assert.Equal(t, expected[i].Kind, diff.Kind, "diff %d", i)
+			assert.Equal(t, expected[i].Path, diff.Path, "diff %d", i)
+
+			if expected[i].Item1 != nil && assert.NotNil(t, diff.Item1) {
+				assert.Equal(t, expected[i].Item1.FullPath, diff.Item1.FullPath)
+				assert.Equal(t, expected[i].Item1.IsDir(), diff.Item1.IsDir())
+			}
+
+			if expected[i].Item2 != nil && assert.NotNil(t, diff.Item2) {
+				assert.Equal(t, expected[i].Item2.FullPath, diff.Item2.FullPath)
+				assert.Equal(t, expected[i].Item2.Size(), diff.Item2.Size())
+			}
+		}
+	}
+}
+
+func TestManifest_Serialization(t *testing.T) {
+	manifest, err := CaptureManifestWithOptions(diffPath("c2"), CompareOptions{Digest: DigestFNV64a})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	var text bytes.Buffer
+	if assert.Nil(t, manifest.WriteText(&text)) {
+		parsed, err := ReadManifestText(&text)
+		if assert.Nil(t, err) {
+			assertManifestsEqual(t, manifest, parsed)
+		}
+	}
+
+	var json bytes.Buffer
+	if assert.Nil(t, manifest.WriteJSON(&json)) {
+		parsed, err := ReadManifestJSON(&json)
+		if assert.Nil(t, err) {
+			assertManifestsEqual(t, manifest, parsed)
+		}
+	}
+}
+
+func TestCaptureManifest_SymlinkLoop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a", "b", "0.txt"), "0")
+	assert.Nil(t, os.Symlink("b", filepath.Join(dir, "a", "sibling")))
+	assert.Nil(t, os.Symlink("..", filepath.Join(dir, "a", "b", "loop")))
+
+	_, err := CaptureManifest(dir)
+	assert.ErrorIs(t, err, ErrSymlinkLoop)
+
+	manifest, err := CaptureManifestWithOptions(dir, CompareOptions{NoFollowSymlinks: true})
+	if assert.Nil(t, err) {
+		assert.Equal(t, 5, len(manifest.Entries))
+	}
+
+	// Links to directories other than ancestors are followed.
+	assert.Nil(t, os.Remove(filepath.Join(dir, "a", "b", "loop")))
+
+	manifest, err = CaptureManifest(dir)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 5, len(manifest.Entries))
+	}
+}
+
+func TestCaptureManifest_DanglingSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a", "0.txt"), "0")
+	assert.Nil(t, os.Symlink("missing", filepath.Join(dir, "a", "dangling")))
+
+	manifest, err := CaptureManifest(dir)
+	if assert.Nil(t, err) && assert.Equal(t, 3, len(manifest.Entries)) {
+		entry := manifest.Entries[2]
+		assert.Equal(t, "a/dangling", entry.Path)
+		assert.Equal(t, EntryTypeSymlink, entry.Type)
+		assert.Equal(t, "missing", entry.Target)
+	}
+
+	// The manifest describes the tree the same way the comparison does.
+	diffs, err := DiffManifest(manifest, dir)
+	assert.Nil(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestDiffManifests_AlgorithmMismatch(t *testing.T) {
+	_, err := DiffManifests(&Manifest{Algorithm: DigestSHA256}, &Manifest{Algorithm: DigestFNV64a})
+	assert.NotNil(t, err)
+}
+
+func TestReadManifestText_Invalid(t *testing.T) {
+	_, err := ReadManifestText(bytes.NewBufferString("# manifest v1 sha256 \"\"\nfile 644 x"))
+	assert.NotNil(t, err)
+}
+
+func assertManifestsEqual(t *testing.T, expected, actual *Manifest) {
+	t.Helper()
+
+	assert.Equal(t, expected.Root, actual.Root)
+	assert.Equal(t, expected.Algorithm, actual.Algorithm)
+
+	if assert.Equal(t, len(expected.Entries), len(actual.Entries)) {
+		for i := range expected.Entries {
+			assert.True(t, expected.Entries[i].ModTime.Equal(actual.Entries[i].ModTime))
+			expected.Entries[i].ModTime = actual.Entries[i].ModTime
+			assert.Equal(t, expected.Entries[i], actual.Entries[i])
+		}
+	}
+
+	diffs, err := DiffManifestsWithOptions(expected, actual, CompareOptions{ComparePermissions: true, CompareModTime: true})
+	assert.Nil(t, err)
+	assert.Zero(t, len(diffs))
+}
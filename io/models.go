@@ -3,11 +3,17 @@ package io
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 )
 
 type FileInfo struct {
 	FullPath string
 	os.FileInfo
+
+	// Tree of the entry, if it is not on the OS file system, e.g. in fs.FS or in an archive.
+	tree tree
 }
 
 func (fi FileInfo) IsFile() bool {
@@ -22,7 +28,196 @@ func (fi FileInfo) String() string {
 	return fmt.Sprintf("{FullPath:%v, FileInfo:%+v}", fi.FullPath, fi.FileInfo)
 }
 
+// DiffKind tells how an entry of the second tree differs from the same entry of the first one.
+type DiffKind int
+
+const (
+	// DiffKindAdded means the entry exists in the second tree only, so Item1 is nil.
+	DiffKindAdded DiffKind = iota + 1
+	// DiffKindRemoved means the entry exists in the first tree only, so Item2 is nil.
+	DiffKindRemoved
+	// DiffKindContentChanged means both entries have the same type, but different content.
+	// The content of a symbolic link is its target, and the content of a device is its number.
+	DiffKindContentChanged
+	// DiffKindTypeChanged means entries have different types, e.g. one is a file and the other one is a directory.
+	DiffKindTypeChanged
+	// DiffKindMetadataChanged means both entries have the same type and content, but different metadata.
+	DiffKindMetadataChanged
+)
+
+var diffKindNames = map[DiffKind]string{
+	DiffKindAdded:           "added",
+	DiffKindRemoved:         "removed",
+	DiffKindContentChanged:  "content changed",
+	DiffKindTypeChanged:     "type changed",
+	DiffKindMetadataChanged: "metadata changed",
+}
+
+func (k DiffKind) String() string {
+	if name, ok := diffKindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("DiffKind(%d)", int(k))
+}
+
+// MarshalText returns the name with underscores instead of spaces, e.g. "content_changed".
+func (k DiffKind) MarshalText() ([]byte, error) {
+	name, ok := diffKindNames[k]
+	if !ok {
+		return nil, fmt.Errorf("unknown diff kind: %d", int(k))
+	}
+
+	return []byte(strings.ReplaceAll(name, " ", "_")), nil
+}
+
+func (k *DiffKind) UnmarshalText(text []byte) error {
+	for kind, name := range diffKindNames {
+		if strings.ReplaceAll(name, " ", "_") == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown diff kind: %s", text)
+}
+
+// DiffReason is a set of metadata changes found for an entry.
+type DiffReason int
+
+const (
+	DiffReasonPermissions DiffReason = 1 << iota
+	DiffReasonModTime
+	DiffReasonOwnership
+	DiffReasonSymlinkTarget
+)
+
+var diffReasonNames = []struct {
+	reason DiffReason
+	name   string
+}{
+	{DiffReasonPermissions, "permissions"},
+	{DiffReasonModTime, "mtime"},
+	{DiffReasonOwnership, "ownership"},
+	{DiffReasonSymlinkTarget, "symlink target"},
+}
+
+func (r DiffReason) Has(reason DiffReason) bool {
+	return r&reason == reason
+}
+
+func (r DiffReason) String() string {
+	return strings.Join(r.names(), ", ")
+}
+
+func (r DiffReason) names() []string {
+	var names []string
+
+	for _, rn := range diffReasonNames {
+		if r.Has(rn.reason) {
+			names = append(names, rn.name)
+			r &^= rn.reason
+		}
+	}
+
+	if r != 0 {
+		names = append(names, fmt.Sprintf("DiffReason(%d)", int(r)))
+	}
+
+	return names
+}
+
 type Diff struct {
+	Kind DiffKind
+
+	// Metadata changes of an entry, present in both trees.
+	// Besides DiffKindMetadataChanged, it may be set for DiffKindContentChanged.
+	// Changed symlink targets are reported as DiffKindContentChanged with DiffReasonSymlinkTarget.
+	Reasons DiffReason
+
+	// Slash-separated path of the entry relative to the compared roots, e.g. "s1/s2/0.bin".
+	Path string
+
 	Item1 *FileInfo
 	Item2 *FileInfo
+
+	// Where contents of changed files differ.
+	// Filled for DiffKindContentChanged diffs of regular files only, if requested by CompareOptions.Content.
+	Content *FileComparison
+}
+
+// HiddenPolicy tells how to treat hidden entries, i.e. ones with names starting with a dot.
+type HiddenPolicy int
+
+const (
+	// HiddenInclude compares hidden entries as any other ones.
+	HiddenInclude HiddenPolicy = iota
+	// HiddenExclude ignores hidden entries and their subtrees in both trees.
+	HiddenExclude
+)
+
+// CompareOptions configures directory comparison.
+// The zero value compares everything, exactly like DirsEqual and DiffDirs do.
+type CompareOptions struct {
+	// Glob patterns (see path.Match) of non-directory entries to compare.
+	// A pattern is matched against both the slash-separated relative path and the base name of an entry.
+	// Directories are traversed and compared only if they contain included entries, so "*.go" compares Go files
+	// at any depth, while directories without Go files are ignored.
+	// An entry is included if it matches any pattern of Include or IncludeRegexps.
+	// Both empty means all entries are included.
+	Include []string
+
+	// Glob patterns of entries to ignore, matched the same way as Include.
+	// An excluded directory is ignored together with its subtree.
+	// Exclude takes precedence over Include.
+	Exclude []string
+
+	// Same as Include, but the expressions are matched against the slash-separated relative path only.
+	IncludeRegexps []*regexp.Regexp
+
+	// Same as Exclude, but the expressions are matched against the slash-separated relative path only.
+	ExcludeRegexps []*regexp.Regexp
+
+	// Maximum depth of compared entries, where children of the roots have depth 1.
+	// Directories at the maximum depth are compared by type only.
+	// Zero or less means unlimited depth.
+	MaxDepth int
+
+	// Set this to true to compare symbolic links themselves instead of the entries they point to.
+	// Two links are considered equal iff their targets, as returned by os.Readlink, are equal.
+	NoFollowSymlinks bool
+
+	// Default is HiddenInclude.
+	Hidden HiddenPolicy
+
+	// Set this to true to report entries with different permission bits, including setuid, setgid and sticky ones.
+	ComparePermissions bool
+
+	// Set this to true to report entries with modification times differing by more than ModTimeTolerance.
+	CompareModTime bool
+
+	// Zero means modification times must be exactly equal.
+	ModTimeTolerance time.Duration
+
+	// Set this to true to report entries with different owner user or group.
+	// Ignored on systems without POSIX ownership, e.g. Windows.
+	CompareOwnership bool
+
+	// Number of files compared concurrently, while directories are still traversed by the calling goroutine.
+	// The order of found diffs does not depend on this value.
+	// Zero or one means files are compared sequentially.
+	Workers int
+
+	// Set this to compare files of the same size by digests instead of reading them simultaneously.
+	// It only pays off together with DigestCache, when the same trees are compared repeatedly.
+	// Default is DigestNone.
+	Digest DigestAlgorithm
+
+	// Optional cache of digests, e.g. MemoryDigestCache or FileDigestCache.
+	// Ignored, if Digest is DigestNone.
+	DigestCache DigestCache
+
+	// Non-nil means Diff.Content of changed files is filled according to these options.
+	// Changed files are read in full or till the first difference, even if their sizes or digests differ.
+	Content *CompareFilesOptions
 }
@@ -0,0 +1,322 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// DefaultArchiveModTime is the earliest time zip archives support.
+var DefaultArchiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type ArchiveOptions struct {
+	// Default is ArchiveUnknown, which means telling the format by the destination extension, see ArchiveFormatOf.
+	Format ArchiveFormat
+
+	// Filters of archived entries, the same as for directory comparison.
+	// Only Include, Exclude, IncludeRegexps, ExcludeRegexps, MaxDepth and Hidden are used.
+	Filter CompareOptions
+
+	// Slash-separated directory, which contains entries inside the archive, e.g. "app-1.0".
+	// Entries are stored at the archive root by default.
+	Prefix string
+
+	// Set this to true to archive entries symbolic links point to instead of the links themselves.
+	FollowSymlinks bool
+
+	// Set this to true to store 0644 permissions for files and 0755 for directories and executable files
+	// instead of actual ones.
+	NoPreserveMode bool
+
+	// Modification time of all entries.
+	// Zero means DefaultArchiveModTime.
+	ModTime time.Time
+
+	// Set this to true to store actual modification times instead of opts.ModTime.
+	PreserveModTime bool
+}
+
+// CreateArchive archives the directory tree into a tar, gzip-compressed tar or zip file.
+// See CreateArchiveContext for details.
+func CreateArchive(srcDir, dst string, opts ArchiveOptions) error {
+	return CreateArchiveContext(context.Background(), srcDir, dst, opts)
+}
+
+// CreateArchiveContext archives the directory tree into a tar, gzip-compressed tar or zip file,
+// which is written atomically, so it is either replaced completely or left intact.
+//
+// The output is reproducible: entries are sorted by names, have the same modification time,
+// and have neither owners nor other metadata, which depends on the system.
+// Hard links are stored as regular files.
+// Entries other than regular files, directories and symbolic links result in ErrUnsupportedPathType.
+func CreateArchiveContext(ctx context.Context, srcDir, dst string, opts ArchiveOptions) (err error) {
+	filter := opts.Filter
+	filter.NoFollowSymlinks = !opts.FollowSymlinks
+
+	if err := filter.validate(); err != nil {
+		return err
+	}
+
+	format := opts.Format
+	if format == ArchiveUnknown {
+		if format = ArchiveFormatOf(dst); format == ArchiveUnknown {
+			return &PathError{Op: "archive", Path: dst, Err: ErrUnknownArchiveFormat}
+		}
+	}
+
+	prefix := "."
+	if opts.Prefix != "" {
+		if prefix, err = cleanArchiveName(opts.Prefix); err != nil {
+			return err
+		}
+	}
+
+	info, err := checkFileOrDir("archive", srcDir, true)
+	if err != nil {
+		return err
+	}
+
+	if within, err := isWithinDir(dst, srcDir); err != nil {
+		return err
+	} else if within {
+		return fmt.Errorf("cannot create an archive inside the archived directory: %s", dst)
+	}
+
+	w, err := NewAtomicWriter(dst, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = w.Abort()
+		}
+	}()
+
+	p := &packer{
+		format:  format,
+		mode:    !opts.NoPreserveMode,
+		modTime: opts.ModTime,
+	}
+
+	if opts.PreserveModTime {
+		p.modTime = time.Time{}
+	} else if p.modTime.IsZero() {
+		p.modTime = DefaultArchiveModTime
+	}
+
+	if err := p.open(w); err != nil {
+		return err
+	}
+
+	if prefix != "." {
+		// Parents of the prefix are stored too, so the archive has no implied directories.
+		var parents []string
+		for dir := prefix; dir != "."; dir = path.Dir(dir) {
+			parents = append(parents, dir)
+		}
+
+		for i := len(parents) - 1; i >= 0; i-- {
+			if err := p.add(srcDir, parents[i], info); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := walkTree(ctx, &filter, srcDir, info, func(itemPath, rel string, info os.FileInfo) error {
+		return p.add(itemPath, path.Join(prefix, rel), info)
+	}); err != nil {
+		return err
+	}
+
+	if err := p.close(); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// packer writes entries into an archive of the format.
+type packer struct {
+	format  ArchiveFormat
+	mode    bool
+	modTime time.Time
+
+	gzipWriter *gzip.Writer
+	tarWriter  *tar.Writer
+	zipWriter  *zip.Writer
+}
+
+func (p *packer) open(w io.Writer) error {
+	switch p.format {
+	case ArchiveTar:
+		p.tarWriter = tar.NewWriter(w)
+	case ArchiveTarGzip:
+		// The header has neither a name nor a modification time, so the output depends on contents only.
+		p.gzipWriter = gzip.NewWriter(w)
+		p.tarWriter = tar.NewWriter(p.gzipWriter)
+	case ArchiveZip:
+		p.zipWriter = zip.NewWriter(w)
+	default:
+		return fmt.Errorf("unknown archive format: %v", p.format)
+	}
+
+	return nil
+}
+
+func (p *packer) close() error {
+	if p.zipWriter != nil {
+		return p.zipWriter.Close()
+	}
+
+	if err := p.tarWriter.Close(); err != nil {
+		return err
+	}
+
+	if p.gzipWriter != nil {
+		return p.gzipWriter.Close()
+	}
+
+	return nil
+}
+
+func (p *packer) add(itemPath, name string, info os.FileInfo) error {
+	mode := p.entryMode(info)
+
+	modTime := p.modTime
+	if modTime.IsZero() {
+		modTime = info.ModTime()
+	}
+
+	var link string
+
+	switch {
+	case isDir(info):
+		name += "/"
+	case isFile(info):
+	case isSymlink(info):
+		target, err := os.Readlink(itemPath)
+		if err != nil {
+			return err
+		}
+
+		link = target
+	default:
+		return errUnsupportedPathType("archive", itemPath)
+	}
+
+	if p.zipWriter != nil {
+		return p.addZip(itemPath, name, mode, modTime, link, info)
+	}
+
+	return p.addTar(itemPath, name, mode, modTime, link, info)
+}
+
+func (p *packer) entryMode(info os.FileInfo) os.FileMode {
+	perm := info.Mode().Perm()
+
+	if !p.mode {
+		switch {
+		case isDir(info), isFile(info) && perm&0111 != 0:
+			perm = 0755
+		default:
+			perm = 0644
+		}
+	}
+
+	if isSymlink(info) {
+		perm = 0777
+	}
+
+	return info.Mode().Type() | perm
+}
+
+func (p *packer) addTar(itemPath, name string, mode os.FileMode, modTime time.Time, link string, info os.FileInfo) error {
+	header := &tar.Header{
+		Name: name,
+		Mode: int64(mode.Perm()),
+		// USTAR stores times with one-second precision, while fractions would require PAX records.
+		ModTime: modTime.Truncate(time.Second),
+	}
+
+	switch {
+	case isDir(info):
+		header.Typeflag = tar.TypeDir
+	case isSymlink(info):
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = link
+	default:
+		header.Typeflag = tar.TypeReg
+		header.Size = info.Size()
+	}
+
+	if err := p.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if header.Typeflag == tar.TypeReg {
+		return copyFileInto(p.tarWriter, itemPath, info.Size())
+	}
+
+	return nil
+}
+
+func (p *packer) addZip(itemPath, name string, mode os.FileMode, modTime time.Time, link string, info os.FileInfo) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Modified: modTime.UTC(),
+		Method:   zip.Deflate,
+	}
+
+	if isDir(info) {
+		header.Method = zip.Store
+	}
+
+	header.SetMode(mode)
+
+	w, err := p.zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case isFile(info):
+		return copyFileInto(w, itemPath, info.Size())
+	case isSymlink(info):
+		_, err = WriteString(w, link)
+		return err
+	default:
+		return nil
+	}
+}
+
+// Copies exactly size bytes of the file, so a file, which has shrunk or grown since it was described,
+// results in an error instead of a corrupted or truncated entry.
+func copyFileInto(w io.Writer, path string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(w, file, size); err != nil {
+		closeQuietly(file)
+		return err
+	}
+
+	var extra [1]byte
+	if n, err := file.Read(extra[:]); n > 0 {
+		closeQuietly(file)
+		return fmt.Errorf("file has grown since it was described: %s", path)
+	} else if err != nil && err != EOF {
+		closeQuietly(file)
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,140 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "c1")
+	assert.Nil(t, os.Mkdir(srcDir, 0755))
+	copyTestTree(t, diffPath("c1"), srcDir)
+
+	for _, name := range []string{"c1.tar", "c1.tar.gz", "c1.zip"} {
+		archivePath := filepath.Join(tempDir, name)
+		if !assert.Nil(t, CreateArchive(srcDir, archivePath, ArchiveOptions{}), name) {
+			continue
+		}
+
+		equal, err := ArchivesEqualContext(context.Background(), archivePath, srcDir, ArchiveCompareOptions{
+			Compare: CompareOptions{ComparePermissions: true},
+		})
+
+		assert.Nil(t, err, name)
+		assert.True(t, equal, name)
+
+		archive, err := OpenArchive(archivePath)
+		if assert.Nil(t, err, name) {
+			info, err := archive.Stat("s5/s2/0.bin")
+			if assert.Nil(t, err, name) {
+				assert.True(t, DefaultArchiveModTime.Equal(info.ModTime()), name)
+			}
+
+			assert.Nil(t, archive.Close())
+		}
+
+		// Modification times of sources do not change the output.
+		contents, err := ioutil.ReadFile(archivePath)
+		assert.Nil(t, err)
+
+		now := time.Now()
+		assert.Nil(t, os.Chtimes(filepath.Join(srcDir, "0.bin"), now, now))
+		assert.Nil(t, CreateArchive(srcDir, archivePath, ArchiveOptions{}))
+
+		recreated, err := ioutil.ReadFile(archivePath)
+		assert.Nil(t, err)
+		assert.Equal(t, contents, recreated, name)
+	}
+
+	assertDirNames(t, tempDir, "c1", "c1.tar", "c1.tar.gz", "c1.zip")
+}
+
+func TestCreateArchive_Options(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	assert.Nil(t, os.Mkdir(srcDir, 0755))
+	copyTestTree(t, diffPath("a1"), srcDir)
+
+	assert.Nil(t, os.Chmod(filepath.Join(srcDir, "0.bin"), 0700))
+	assert.Nil(t, os.Chmod(filepath.Join(srcDir, "1.bin"), 0600))
+	assert.Nil(t, os.Symlink("0.bin", filepath.Join(srcDir, "link")))
+
+	modTime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	for _, name := range []string{"a1.tgz", "a1.zip"} {
+		archivePath := filepath.Join(tempDir, name)
+
+		if !assert.Nil(t, CreateArchive(srcDir, archivePath, ArchiveOptions{
+			Prefix:         "app/1.0",
+			NoPreserveMode: true,
+			ModTime:        modTime,
+			Filter:         CompareOptions{Exclude: []string{"empty.txt"}},
+		}), name) {
+			continue
+		}
+
+		archive, err := OpenArchive(archivePath)
+		if !assert.Nil(t, err, name) {
+			continue
+		}
+
+		entries, err := archive.ReadDir("app/1.0")
+		if assert.Nil(t, err, name) && assert.Equal(t, 3, len(entries), name) {
+			assert.Equal(t, "0.bin", entries[0].Name())
+			assert.Equal(t, "1.bin", entries[1].Name())
+			assert.Equal(t, "link", entries[2].Name())
+		}
+
+		for entryName, mode := range map[string]os.FileMode{
+			"app":           os.ModeDir | 0755,
+			"app/1.0":       os.ModeDir | 0755,
+			"app/1.0/0.bin": 0755,
+			"app/1.0/1.bin": 0644,
+		} {
+			info, err := archive.Lstat(entryName)
+			if assert.Nil(t, err, entryName) {
+				assert.Equal(t, mode, info.Mode(), entryName)
+				assert.True(t, modTime.Equal(info.ModTime()), entryName)
+			}
+		}
+
+		target, err := archive.ReadLink("app/1.0/link")
+		assert.Nil(t, err, name)
+		assert.Equal(t, "0.bin", target, name)
+
+		assert.Nil(t, archive.Close())
+	}
+
+	err := CreateArchive(srcDir, filepath.Join(srcDir, "src.zip"), ArchiveOptions{})
+	assert.NotNil(t, err)
+
+	err = CreateArchive(srcDir, filepath.Join(tempDir, "src.rar"), ArchiveOptions{})
+	assert.ErrorIs(t, err, ErrUnknownArchiveFormat)
+
+	err = CreateArchive(srcDir, filepath.Join(tempDir, "src.tar"), ArchiveOptions{Prefix: "../app"})
+	assert.ErrorIs(t, err, ErrUnsafeArchivePath)
+
+	assertDirNames(t, srcDir, "0.bin", "1.bin", "empty.txt", "link")
+	assertDirNames(t, tempDir, "a1.tgz", "a1.zip", "src")
+}
+
+func TestCopyFileInto_Changed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	writeTestFile(t, path, "0123456789")
+
+	var buf bytes.Buffer
+	assert.Nil(t, copyFileInto(&buf, path, 10))
+	assert.Equal(t, "0123456789", buf.String())
+
+	// The file has grown or shrunk since it was described.
+	assert.NotNil(t, copyFileInto(ioutil.Discard, path, 9))
+	assert.NotNil(t, copyFileInto(ioutil.Discard, path, 11))
+}
@@ -0,0 +1,153 @@
+package io
+
+import (
+	"context"
+	"sync"
+)
+
+// Number of queued results per worker, which bounds memory used to keep the output order.
+const comparePoolQueueFactor = 16
+
+// comparePool compares files concurrently and reports their diffs in the order of submission.
+type comparePool struct {
+	// Called for every found diff in the order of submission.
+	// Nil means only equality is checked, so the pool stops at the first difference.
+	emit func(diff Diff) error
+
+	jobs  chan *pendingDiff
+	queue chan *pendingDiff
+
+	workers sync.WaitGroup
+	drained chan struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+
+	// Written by the draining goroutine only, read after drained is closed.
+	equal bool
+	err   error
+}
+
+type pendingDiff struct {
+	// Nil means the diff is already known.
+	compare func() (*Diff, error)
+
+	// Nil means no difference.
+	diff *Diff
+	err  error
+
+	done chan struct{}
+}
+
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// Returns the pool and a context, which is canceled, when the pool stops or the parent context is done.
+func newComparePool(parent context.Context, workers int, emit func(diff Diff) error) (context.Context, *comparePool) {
+	ctx, cancel := context.WithCancel(parent)
+
+	p := &comparePool{
+		emit:    emit,
+		jobs:    make(chan *pendingDiff, workers),
+		queue:   make(chan *pendingDiff, workers*comparePoolQueueFactor),
+		drained: make(chan struct{}),
+		stop:    make(chan struct{}),
+		cancel:  cancel,
+		equal:   true,
+	}
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	go p.drain()
+
+	return ctx, p
+}
+
+func (p *comparePool) work() {
+	defer p.workers.Done()
+
+	for pending := range p.jobs {
+		if !p.stopped() {
+			pending.diff, pending.err = pending.compare()
+		}
+
+		close(pending.done)
+	}
+}
+
+func (p *comparePool) drain() {
+	defer close(p.drained)
+
+	for pending := range p.queue {
+		<-pending.done
+
+		if p.stopped() {
+			// Results are not needed anymore, and errors are likely caused by the cancellation.
+			continue
+		}
+
+		if pending.err != nil {
+			if p.err == nil {
+				p.err = pending.err
+			}
+
+			p.stopNow()
+		} else if pending.diff != nil {
+			p.equal = false
+
+			if p.emit == nil {
+				p.stopNow()
+			} else if err := p.emit(*pending.diff); err != nil {
+				p.err = err
+				p.stopNow()
+			}
+		}
+	}
+}
+
+func (p *comparePool) stopNow() {
+	p.stopOnce.Do(func() {
+		// Close the channel first, so that the cancellation is never mistaken for a parent context error.
+		close(p.stop)
+		p.cancel()
+	})
+}
+
+func (p *comparePool) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reports an already known diff after all previously submitted comparisons.
+func (p *comparePool) report(diff Diff) {
+	p.queue <- &pendingDiff{diff: &diff, done: closedChan}
+}
+
+func (p *comparePool) submit(compare func() (*Diff, error)) {
+	pending := &pendingDiff{compare: compare, done: make(chan struct{})}
+	p.queue <- pending
+	p.jobs <- pending
+}
+
+// Waits for all submitted comparisons to finish and returns the combined result.
+func (p *comparePool) close() (bool, error) {
+	close(p.jobs)
+	close(p.queue)
+
+	p.workers.Wait()
+	<-p.drained
+	p.cancel()
+
+	return p.equal, p.err
+}
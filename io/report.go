@@ -0,0 +1,285 @@
+package io
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Status letters used by WriteSummary, similar to the ones of "git status --short".
+var diffKindStatuses = map[DiffKind]string{
+	DiffKindAdded:           "A",
+	DiffKindRemoved:         "D",
+	DiffKindContentChanged:  "M",
+	DiffKindTypeChanged:     "T",
+	DiffKindMetadataChanged: "m",
+}
+
+// DiffCounts is the number of diffs per kind.
+type DiffCounts map[DiffKind]int
+
+// CountDiffs counts diffs per kind.
+func CountDiffs(diffs []Diff) DiffCounts {
+	counts := make(DiffCounts)
+
+	for _, diff := range diffs {
+		counts[diff.Kind]++
+	}
+
+	return counts
+}
+
+// Total returns the number of all counted diffs.
+func (c DiffCounts) Total() int {
+	total := 0
+
+	for _, count := range c {
+		total += count
+	}
+
+	return total
+}
+
+// String returns non-zero counts in the order of kinds, e.g. "2 added, 1 content changed".
+func (c DiffCounts) String() string {
+	kinds := make([]DiffKind, 0, len(c))
+	for kind, count := range c {
+		if count > 0 {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	if len(kinds) <= 0 {
+		return "no differences"
+	}
+
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i] < kinds[j]
+	})
+
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d %v", c[kind], kind)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// WriteSummary writes one line per diff in the style of "git status --short", followed by counts:
+//
+//	D  s0/
+//	A  s1/S2/
+//	M  s1/s1/0.bin
+//	T  s5/s3/0.bin
+//	m  s5/s4/1.bin (permissions, mtime)
+//
+//	2 added, 1 removed, 1 content changed, 1 type changed, 1 metadata changed
+//
+// Letters mean added, deleted, modified content, changed type and changed metadata only.
+// Directories end with a slash, and metadata changes are listed in parentheses.
+func WriteSummary(w io.Writer, diffs []Diff) error {
+	bw := bufio.NewWriter(w)
+
+	for _, diff := range diffs {
+		status, ok := diffKindStatuses[diff.Kind]
+		if !ok {
+			status = "?"
+		}
+
+		line := status + "  " + diff.Path
+		if item := diff.Item2; item != nil && item.IsDir() || item == nil && diff.Item1 != nil && diff.Item1.IsDir() {
+			line += "/"
+		}
+
+		if diff.Reasons != 0 {
+			line += " (" + diff.Reasons.String() + ")"
+		}
+
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+
+	if len(diffs) > 0 {
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintln(bw, CountDiffs(diffs)); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// WritePatch writes unified diffs of all changed files one after another, like "diff -ruN" does,
+// so the result can be applied by "patch -p0" or stored as a single artifact.
+func WritePatch(w io.Writer, diffs []Diff, opts UnifiedOptions) error {
+	for _, diff := range diffs {
+		if diff.Kind != DiffKindAdded && diff.Kind != DiffKindRemoved && diff.Kind != DiffKindContentChanged {
+			continue
+		}
+
+		if diff.Item1 != nil && !isFile(diff.Item1) || diff.Item2 != nil && !isFile(diff.Item2) {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "diff -u %s %s\n", diffItemPath(diff.Item1), diffItemPath(diff.Item2)); err != nil {
+			return err
+		}
+
+		if err := WriteUnifiedDiff(w, diff, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type ReportOptions struct {
+	// Set this to add digests of regular files to report items.
+	// Default is DigestNone, i.e. no digests.
+	// Diffs of manifests are reported with the digests they have, so the algorithm must match the manifest one.
+	Digest DigestAlgorithm
+
+	// Optional cache of digests, ignored if Digest is DigestNone.
+	DigestCache DigestCache
+
+	// Set this to true to add modification times to report items.
+	// They are omitted by default, because they usually differ across runs.
+	ModTimes bool
+}
+
+// Report is a serializable form of diffs, which only contains data stable across runs,
+// e.g. relative paths instead of full ones.
+type Report struct {
+	Counts  DiffCounts    `json:"counts"`
+	Entries []ReportEntry `json:"entries"`
+}
+
+type ReportEntry struct {
+	Path    string      `json:"path"`
+	Kind    DiffKind    `json:"kind"`
+	Reasons []string    `json:"reasons,omitempty"`
+	Item1   *ReportItem `json:"item1,omitempty"`
+	Item2   *ReportItem `json:"item2,omitempty"`
+
+	// Offset and line of the first difference, present if the diff has content details.
+	Offset *int64 `json:"offset,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+type ReportItem struct {
+	Type    EntryType  `json:"type"`
+	Size    int64      `json:"size"`
+	Mode    string     `json:"mode"`
+	ModTime *time.Time `json:"mtime,omitempty"`
+	Digest  string     `json:"digest,omitempty"`
+}
+
+// NewReport converts diffs into a report, reading files, if digests are requested.
+// Files are read in the trees they were compared in, e.g. in fs.FS of DiffFS.
+// Entries of archives cannot be read, after the archives are closed by DiffArchives, so fs.ErrClosed is returned.
+func NewReport(diffs []Diff, opts ReportOptions) (*Report, error) {
+	report := &Report{
+		Counts:  CountDiffs(diffs),
+		Entries: make([]ReportEntry, 0, len(diffs)),
+	}
+
+	for _, diff := range diffs {
+		entry := ReportEntry{
+			Path:    diff.Path,
+			Kind:    diff.Kind,
+			Reasons: diff.Reasons.names(),
+		}
+
+		var err error
+
+		if entry.Item1, err = newReportItem(diff.Item1, &opts); err != nil {
+			return nil, err
+		}
+
+		if entry.Item2, err = newReportItem(diff.Item2, &opts); err != nil {
+			return nil, err
+		}
+
+		if diff.Content != nil && !diff.Content.Equal {
+			offset := diff.Content.Offset
+			entry.Offset = &offset
+			entry.Line = diff.Content.Line
+		}
+
+		report.Entries = append(report.Entries, entry)
+	}
+
+	return report, nil
+}
+
+func newReportItem(info *FileInfo, opts *ReportOptions) (*ReportItem, error) {
+	if info == nil {
+		return nil, nil
+	}
+
+	item := &ReportItem{
+		Type: entryType(info),
+		Mode: info.Mode().String(),
+	}
+
+	// Directory sizes depend on the file system, so they are omitted for stability.
+	if item.Type != EntryTypeDir {
+		item.Size = info.Size()
+	}
+
+	if opts.ModTimes {
+		modTime := info.ModTime().UTC()
+		item.ModTime = &modTime
+	}
+
+	if opts.Digest != DigestNone && item.Type == EntryTypeFile {
+		if fi, ok := info.FileInfo.(manifestFileInfo); ok {
+			// Manifest entries are not files on disk, so their digests cannot be recomputed with another algorithm.
+			if fi.algorithm != opts.Digest {
+				return nil, &PathError{
+					Op:   "report",
+					Path: info.FullPath,
+					Err:  fmt.Errorf("manifest digest algorithm %v differs from %v", fi.algorithm, opts.Digest),
+				}
+			}
+
+			item.Digest = fi.entry.Digest
+		} else {
+			digest, err := fileInfoDigest(context.Background(), info, opts.Digest, opts.DigestCache)
+			if err != nil {
+				return nil, err
+			}
+
+			item.Digest = hex.EncodeToString(digest)
+		}
+	}
+
+	return item, nil
+}
+
+// ReadReportJSON reads a report written by Report.WriteJSON.
+func ReadReportJSON(r io.Reader) (*Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// WriteJSON writes the report as an indented JSON object, which is stable for the same diffs.
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(r)
+}
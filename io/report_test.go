@@ -0,0 +1,168 @@
+package io
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSummaryC(t *testing.T) {
+	diffs, err := DiffDirs(diffPath("c1"), diffPath("c2"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	var summary strings.Builder
+	assert.Nil(t, WriteSummary(&summary, diffs))
+	assert.Equal(t, ""+
+		"D  s0/\n"+
+		"A  s1/S2/\n"+
+		"M  s1/s1/0.bin\n"+
+		"D  s1/s2/\n"+
+		"A  s2/\n"+
+		"D  s3/\n"+
+		"A  s4/\n"+
+		"A  s5/aa/\n"+
+		"D  s5/s0/0.bin\n"+
+		"A  s5/s0/1.bin\n"+
+		"M  s5/s2/0.bin\n"+
+		"A  s5/s2/1.bin\n"+
+		"T  s5/s3/0.bin/\n"+
+		"A  s5/zz/\n"+
+		"A  s6/\n"+
+		"\n"+
+		"8 added, 4 removed, 2 content changed, 1 type changed\n", summary.String())
+}
+
+func TestWriteSummary_Empty(t *testing.T) {
+	var summary strings.Builder
+	assert.Nil(t, WriteSummary(&summary, nil))
+	assert.Equal(t, "no differences\n", summary.String())
+}
+
+func TestReportC_JSON(t *testing.T) {
+	diffs, err := DiffDirsWithOptions(diffPath("c1"), diffPath("c2"), CompareOptions{Content: &CompareFilesOptions{}})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	report, err := NewReport(diffs, ReportOptions{Digest: DigestSHA256})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, DiffCounts{
+		DiffKindAdded:          8,
+		DiffKindRemoved:        4,
+		DiffKindContentChanged: 2,
+		DiffKindTypeChanged:    1,
+	}, report.Counts)
+
+	entry := report.Entries[2]
+	assert.Equal(t, "s1/s1/0.bin", entry.Path)
+	assert.Equal(t, DiffKindContentChanged, entry.Kind)
+	if assert.NotNil(t, entry.Item1) && assert.NotNil(t, entry.Item2) {
+		assert.Equal(t, EntryTypeFile, entry.Item1.Type)
+		assert.Equal(t, 64, len(entry.Item1.Digest))
+		assert.NotEqual(t, entry.Item1.Digest, entry.Item2.Digest)
+		assert.Nil(t, entry.Item1.ModTime)
+	}
+	if assert.NotNil(t, entry.Offset) {
+		assert.Equal(t, diffs[2].Content.Offset, *entry.Offset)
+	}
+
+	var json1, json2 bytes.Buffer
+	assert.Nil(t, report.WriteJSON(&json1))
+	assert.Contains(t, json1.String(), `"content_changed": 2`)
+	assert.NotContains(t, json1.String(), diffPath("c1"))
+
+	parsed, err := ReadReportJSON(bytes.NewReader(json1.Bytes()))
+	if assert.Nil(t, err) {
+		assert.Equal(t, report, parsed)
+		assert.Nil(t, parsed.WriteJSON(&json2))
+		assert.Equal(t, json1.String(), json2.String())
+	}
+}
+
+func TestWritePatchC(t *testing.T) {
+	diffs, err := DiffDirs(diffPath("c1"), diffPath("c2"))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	var patch strings.Builder
+	assert.Nil(t, WritePatch(&patch, diffs, UnifiedOptions{}))
+	assert.Equal(t, 5, strings.Count(patch.String(), "\ndiff -u ")+1)
+	assert.Contains(t, patch.String(), "diff -u "+diffPath("c1/s5/s0/0.bin")+" /dev/null\n")
+}
+
+func TestReport_FS(t *testing.T) {
+	fsys1 := fstest.MapFS{
+		"a.txt":       {Data: []byte("a\n")},
+		"removed.txt": {Data: []byte("removed\n")},
+	}
+
+	fsys2 := fstest.MapFS{
+		"a.txt": {Data: []byte("A\n")},
+	}
+
+	// Files are read from the file systems, so OS files with the same paths are not mistaken for them.
+	diffs, err := DiffFS(fsys1, ".", fsys2, ".")
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(diffs)) {
+		t.FailNow()
+	}
+
+	report, err := NewReport(diffs, ReportOptions{Digest: DigestSHA256})
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(report.Entries)) {
+		digest := sha256.Sum256([]byte("A\n"))
+		assert.Equal(t, hex.EncodeToString(digest[:]), report.Entries[0].Item2.Digest)
+
+		digest = sha256.Sum256([]byte("removed\n"))
+		assert.Equal(t, hex.EncodeToString(digest[:]), report.Entries[1].Item1.Digest)
+	}
+
+	// Archives are closed, when they are compared.
+	tempDir := t.TempDir()
+	writeTestArchive(t, diffPath("c1"), "", filepath.Join(tempDir, "c1.zip"))
+	writeTestArchive(t, diffPath("c2"), "", filepath.Join(tempDir, "c2.zip"))
+
+	diffs, err = DiffArchives(filepath.Join(tempDir, "c1.zip"), filepath.Join(tempDir, "c2.zip"))
+	if assert.Nil(t, err) && assert.NotEmpty(t, diffs) {
+		_, err = NewReport(diffs, ReportOptions{Digest: DigestSHA256})
+		assert.ErrorIs(t, err, fs.ErrClosed)
+	}
+}
+
+func TestReport_Manifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a\n")
+
+	manifest, err := CaptureManifestWithOptions(dir, CompareOptions{Digest: DigestFNV64a})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "A\n")
+
+	diffs, err := DiffManifest(manifest, dir)
+	if !assert.Nil(t, err) || !assert.Equal(t, 1, len(diffs)) {
+		t.FailNow()
+	}
+
+	report, err := NewReport(diffs, ReportOptions{Digest: DigestFNV64a})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(report.Entries)) {
+		assert.Equal(t, manifest.Entries[0].Digest, report.Entries[0].Item1.Digest)
+		assert.NotEqual(t, report.Entries[0].Item1.Digest, report.Entries[0].Item2.Digest)
+	}
+
+	// Digests of manifest entries cannot be recomputed.
+	_, err = NewReport(diffs, ReportOptions{Digest: DigestSHA256})
+	assert.NotNil(t, err)
+}
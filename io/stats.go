@@ -0,0 +1,163 @@
+package io
+
+import (
+	"context"
+	"os"
+	"sort"
+)
+
+const DefaultLargestFiles = 10
+
+type DirStatsOptions struct {
+	// Filters of counted entries, the same as for directory comparison.
+	// Only Include, Exclude, IncludeRegexps, ExcludeRegexps, MaxDepth and Hidden are used.
+	Filter CompareOptions
+
+	// Set this to true to count entries symbolic links point to instead of the links themselves,
+	// so a link to a file adds to Files and Size. Dangling links are counted as Symlinks anyway.
+	FollowSymlinks bool
+
+	// Number of largest files to collect.
+	// Use a negative value to collect none.
+	// Zero means DefaultLargestFiles.
+	LargestFiles int
+}
+
+// TreeStats describes the size and the structure of a directory tree.
+type TreeStats struct {
+	// Total apparent size of regular files, i.e. the number of bytes they contain.
+	Size int64
+
+	// Total size of disk blocks allocated for regular files, which may be less than Size for sparse files.
+	// It equals to Size on systems, which do not report allocated blocks, e.g. Windows.
+	AllocatedSize int64
+
+	// Numbers of entries in the tree, excluding the root.
+	// Hard links to the same file are counted as separate files.
+	Files    int
+	Dirs     int
+	Symlinks int
+	Others   int
+
+	// Number of files, which are hard links to files already counted, so their sizes are not added again.
+	HardLinks int
+
+	// The largest regular files in descending order of sizes.
+	LargestFiles []*FileInfo
+
+	// Slash-separated relative path of the deepest entry and its depth, where children of the root have depth 1.
+	// The first entry in the order of names is taken among entries of the same depth.
+	DeepestPath  string
+	DeepestDepth int
+}
+
+// DirStats walks the directory tree and counts its entries and their sizes, like "du" does.
+func DirStats(path string, opts DirStatsOptions) (*TreeStats, error) {
+	return DirStatsContext(context.Background(), path, opts)
+}
+
+// DirStatsContext is the same as DirStats, but stops and returns ctx.Err() as soon as the context is done.
+func DirStatsContext(ctx context.Context, path string, opts DirStatsOptions) (*TreeStats, error) {
+	filter := opts.Filter
+	filter.NoFollowSymlinks = !opts.FollowSymlinks
+
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	info, err := checkFileOrDir("stats", path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	largest := opts.LargestFiles
+	if largest == 0 {
+		largest = DefaultLargestFiles
+	} else if largest < 0 {
+		largest = 0
+	}
+
+	w := &statsWalker{
+		largest: largest,
+		stats:   &TreeStats{},
+		inodes:  make(map[inodeKey]bool),
+	}
+
+	if err := walkTree(ctx, &filter, path, info, w.visit); err != nil {
+		return nil, err
+	}
+
+	return w.stats, nil
+}
+
+type statsWalker struct {
+	largest int
+	stats   *TreeStats
+
+	// Inodes of counted files with several hard links.
+	inodes map[inodeKey]bool
+}
+
+func (w *statsWalker) visit(path, rel string, info os.FileInfo) error {
+	if itemDepth := depth(rel); itemDepth > w.stats.DeepestDepth {
+		w.stats.DeepestPath, w.stats.DeepestDepth = rel, itemDepth
+	}
+
+	switch {
+	case isDir(info):
+		w.stats.Dirs++
+	case isFile(info):
+		w.addFile(&FileInfo{FileInfo: info, FullPath: path})
+	case isSymlink(info):
+		w.stats.Symlinks++
+	default:
+		w.stats.Others++
+	}
+
+	return nil
+}
+
+func (w *statsWalker) addFile(info *FileInfo) {
+	w.stats.Files++
+
+	if dev, ino, nlink, ok := fileInode(info); ok && nlink > 1 {
+		key := inodeKey{dev: dev, ino: ino}
+		if w.inodes[key] {
+			w.stats.HardLinks++
+			return
+		}
+
+		w.inodes[key] = true
+	}
+
+	w.stats.Size += info.Size()
+
+	if allocated, ok := fileAllocatedSize(info); ok {
+		w.stats.AllocatedSize += allocated
+	} else {
+		w.stats.AllocatedSize += info.Size()
+	}
+
+	if w.largest <= 0 {
+		return
+	}
+
+	largest := w.stats.LargestFiles
+	if len(largest) >= w.largest && largest[len(largest)-1].Size() >= info.Size() {
+		return
+	}
+
+	i := sort.Search(len(largest), func(i int) bool {
+		return largest[i].Size() < info.Size()
+	})
+
+	largest = append(largest, nil)
+	copy(largest[i+1:], largest[i:])
+	largest[i] = info
+
+	if len(largest) > w.largest {
+		largest = largest[:w.largest]
+	}
+
+	w.stats.LargestFiles = largest
+}
@@ -0,0 +1,107 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirStatsC(t *testing.T) {
+	stats, err := DirStats(diffPath("c2"), DirStatsOptions{LargestFiles: 2})
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(3*2560000+4*512000), stats.Size)
+		assert.True(t, stats.AllocatedSize > 0)
+		assert.Equal(t, 15, stats.Files)
+		assert.Equal(t, 15, stats.Dirs)
+		assert.Equal(t, 0, stats.HardLinks)
+		assert.Equal(t, "s5/s3/0.bin/empty.txt", stats.DeepestPath)
+		assert.Equal(t, 4, stats.DeepestDepth)
+
+		if assert.Equal(t, 2, len(stats.LargestFiles)) {
+			assert.Equal(t, diffPath("c2/0.bin"), stats.LargestFiles[0].FullPath)
+			assert.Equal(t, diffPath("c2/s1/s0/0.bin"), stats.LargestFiles[1].FullPath)
+		}
+	}
+
+	stats, err = DirStats(diffPath("c2"), DirStatsOptions{Filter: CompareOptions{MaxDepth: 1}, LargestFiles: -1})
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(2560000), stats.Size)
+		assert.Equal(t, 1, stats.Files)
+		assert.Equal(t, 5, stats.Dirs)
+		assert.Equal(t, 1, stats.DeepestDepth)
+		assert.Empty(t, stats.LargestFiles)
+	}
+
+	_, err = DirStats(diffPath("c2/0.bin"), DirStatsOptions{})
+	assert.ErrorIs(t, err, ErrNotDir)
+}
+
+func TestDirStats_Links(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("links require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "12345")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "123")
+	writeTestFile(t, filepath.Join(dir, ".hidden"), "1234567")
+	assert.Nil(t, os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "hard.txt")))
+	assert.Nil(t, os.Symlink("..", filepath.Join(dir, "sub", "loop")))
+	assert.Nil(t, os.Symlink("b.txt", filepath.Join(dir, "sub", "link.txt")))
+	assert.Nil(t, os.Symlink("missing", filepath.Join(dir, "sub", "dangling")))
+
+	// Links are counted as links.
+	stats, err := DirStats(dir, DirStatsOptions{Filter: CompareOptions{Hidden: HiddenExclude}})
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(8), stats.Size)
+		assert.Equal(t, 3, stats.Files)
+		assert.Equal(t, 1, stats.HardLinks)
+		assert.Equal(t, 1, stats.Dirs)
+		assert.Equal(t, 3, stats.Symlinks)
+		assert.Equal(t, "sub/b.txt", stats.DeepestPath)
+
+		if assert.Equal(t, 2, len(stats.LargestFiles)) {
+			assert.Equal(t, filepath.Join(dir, "a.txt"), stats.LargestFiles[0].FullPath)
+		}
+	}
+
+	stats, err = DirStats(dir, DirStatsOptions{Filter: CompareOptions{Exclude: []string{"*.txt"}}})
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(7), stats.Size)
+		assert.Equal(t, 1, stats.Files)
+		assert.Equal(t, 1, stats.Dirs)
+		assert.Equal(t, 2, stats.Symlinks)
+	}
+
+	// Followed links are counted as their targets, except the dangling one.
+	stats, err = DirStats(dir, DirStatsOptions{Filter: CompareOptions{Hidden: HiddenExclude}, FollowSymlinks: true})
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(11), stats.Size)
+		assert.Equal(t, 4, stats.Files)
+		assert.Equal(t, 2, stats.Dirs)
+		assert.Equal(t, 1, stats.Symlinks)
+	}
+}
+
+func TestDirStats_IncludeThroughLoop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	// The directory b is checked for included entries, while its parent is still being checked,
+	// so its link to the parent must not be memoised as a link without included entries.
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a", "z.txt"), "z")
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "a", "b"), 0755))
+	assert.Nil(t, os.Symlink("..", filepath.Join(dir, "a", "b", "loop")))
+
+	stats, err := DirStats(dir, DirStatsOptions{Filter: CompareOptions{Include: []string{"*.txt"}}, FollowSymlinks: true})
+	if assert.Nil(t, err) {
+		// The directories a, b and the link to a, which is not entered again.
+		assert.Equal(t, 3, stats.Dirs)
+		assert.Equal(t, 1, stats.Files)
+	}
+}
@@ -0,0 +1,121 @@
+package io
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// DefaultMaxSymlinkHops is the same limit Linux uses when resolving paths.
+const DefaultMaxSymlinkHops = 40
+
+func lexists(path string) (bool, error) {
+	if len(path) <= 0 {
+		return false, ErrEmptyPath
+	}
+
+	_, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func isSymlinkPath(path string) (bool, error) {
+	if len(path) <= 0 {
+		return false, ErrEmptyPath
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return isSymlink(info), nil
+}
+
+func isBrokenSymlink(path string) (bool, error) {
+	if isSymlink, err := isSymlinkPath(path); err != nil || !isSymlink {
+		return false, err
+	}
+
+	target, err := resolveSymlink(path, DefaultMaxSymlinkHops)
+	if errors.Is(err, ErrSymlinkLoop) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	exists, err := lexists(target)
+	return !exists, err
+}
+
+// Follows the chain of symbolic links, starting at the path, till the first entry, which is not a link.
+// Only the last path element is resolved on each hop, so links among parent directories are kept as is.
+func resolveSymlink(path string, maxHops int) (string, error) {
+	if len(path) <= 0 {
+		return "", ErrEmptyPath
+	}
+
+	if maxHops <= 0 {
+		maxHops = DefaultMaxSymlinkHops
+	}
+
+	visited := make(map[string]bool)
+	current := filepath.Clean(path)
+
+	for hops := 0; ; hops++ {
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) || err == nil && !isSymlink(info) {
+			return current, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		abs, err := filepath.Abs(current)
+		if err != nil {
+			return "", err
+		}
+
+		if visited[abs] || hops >= maxHops {
+			return "", &PathError{Op: "resolve", Path: path, Err: ErrSymlinkLoop}
+		}
+
+		visited[abs] = true
+
+		target, err := os.Readlink(current)
+		if err != nil {
+			return "", err
+		}
+
+		if filepath.IsAbs(target) {
+			current = filepath.Clean(target)
+		} else {
+			current = filepath.Join(filepath.Dir(current), target)
+		}
+	}
+}
+
+// Builds FileInfo of the path, describing the symbolic link itself, if follow is false.
+func newFileInfo(path string, follow bool) (*FileInfo, error) {
+	if len(path) <= 0 {
+		return nil, ErrEmptyPath
+	}
+
+	stat := os.Lstat
+	if follow {
+		stat = os.Stat
+	}
+
+	info, err := stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileInfo{FileInfo: info, FullPath: path}, nil
+}
@@ -0,0 +1,91 @@
+package io
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	writeTestFile(t, file, "content")
+
+	link := filepath.Join(dir, "link")
+	chain := filepath.Join(dir, "chain")
+	dangling := filepath.Join(dir, "dangling")
+	loop1, loop2 := filepath.Join(dir, "loop1"), filepath.Join(dir, "loop2")
+
+	assert.Nil(t, os.Symlink("file.txt", link))
+	assert.Nil(t, os.Symlink(link, chain))
+	assert.Nil(t, os.Symlink("missing.txt", dangling))
+	assert.Nil(t, os.Symlink("loop2", loop1))
+	assert.Nil(t, os.Symlink("loop1", loop2))
+
+	for _, test := range []struct {
+		path                string
+		exists, lexists     bool
+		isSymlink, isBroken bool
+		resolved            string
+		loop                bool
+	}{
+		{path: file, exists: true, lexists: true, resolved: file},
+		{path: link, exists: true, lexists: true, isSymlink: true, resolved: file},
+		{path: chain, exists: true, lexists: true, isSymlink: true, resolved: file},
+		{path: dangling, lexists: true, isSymlink: true, isBroken: true, resolved: filepath.Join(dir, "missing.txt")},
+		{path: loop1, lexists: true, isSymlink: true, isBroken: true, loop: true},
+		{path: filepath.Join(dir, "missing.txt"), resolved: filepath.Join(dir, "missing.txt")},
+	} {
+		exists, err := Exists(test.path)
+		if !test.loop {
+			assert.Nil(t, err, test.path)
+			assert.Equal(t, test.exists, exists, test.path)
+		}
+
+		lexists, err := Lexists(test.path)
+		assert.Nil(t, err, test.path)
+		assert.Equal(t, test.lexists, lexists, test.path)
+
+		isSymlink, err := IsSymlink(test.path)
+		assert.Nil(t, err, test.path)
+		assert.Equal(t, test.isSymlink, isSymlink, test.path)
+
+		isBroken, err := IsBrokenSymlink(test.path)
+		assert.Nil(t, err, test.path)
+		assert.Equal(t, test.isBroken, isBroken, test.path)
+
+		resolved, err := ResolveSymlink(test.path)
+		if test.loop {
+			assert.ErrorIs(t, err, ErrSymlinkLoop, test.path)
+		} else {
+			assert.Nil(t, err, test.path)
+			assert.Equal(t, test.resolved, resolved, test.path)
+		}
+	}
+
+	_, err := ResolveSymlinkWithMaxHops(chain, 1)
+	assert.True(t, errors.Is(err, ErrSymlinkLoop))
+
+	info, err := Lstat(link)
+	if assert.Nil(t, err) {
+		assert.True(t, info.IsSymlink())
+		assert.Equal(t, link, info.FullPath)
+	}
+
+	info, err = Stat(link)
+	if assert.Nil(t, err) {
+		assert.False(t, info.IsSymlink())
+		assert.True(t, info.IsFile())
+	}
+
+	_, err = Lexists("")
+	assert.Equal(t, ErrEmptyPath, err)
+}
@@ -0,0 +1,251 @@
+package io
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// SyncActionKind is a kind of change SyncDirs makes to the destination directory.
+type SyncActionKind int
+
+const (
+	// SyncCopy copies an added or changed entry from the source, together with its subtree.
+	SyncCopy SyncActionKind = iota + 1
+	// SyncReplace removes the destination entry of another type and copies the source one.
+	SyncReplace
+	// SyncDelete removes an entry, which is absent in the source, together with its subtree.
+	SyncDelete
+	// SyncUpdateMetadata applies permissions, modification time or ownership of the source entry.
+	SyncUpdateMetadata
+)
+
+var syncActionKindNames = map[SyncActionKind]string{
+	SyncCopy:           "copy",
+	SyncReplace:        "replace",
+	SyncDelete:         "delete",
+	SyncUpdateMetadata: "update metadata",
+}
+
+func (k SyncActionKind) String() string {
+	if name, ok := syncActionKindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("SyncActionKind(%d)", int(k))
+}
+
+// SyncAction is a single change SyncDirs makes to the destination directory.
+type SyncAction struct {
+	Kind SyncActionKind
+
+	// Slash-separated path of the entry relative to the directories.
+	Path string
+
+	// The diff, which caused the action.
+	// Its Item1 is the destination entry and Item2 is the source one.
+	Diff Diff
+}
+
+func (a SyncAction) String() string {
+	return a.Kind.String() + " " + a.Path
+}
+
+type SyncOptions struct {
+	// Options of the comparison, which finds entries to synchronize.
+	// Excluded entries are neither copied nor deleted.
+	// Metadata comparison flags make SyncDirs update metadata of otherwise equal entries.
+	Compare CompareOptions
+
+	// Set this to true to delete destination entries, which are absent in the source.
+	Delete bool
+
+	// Set this to true to give copied files 0644 and new directories 0755 permissions instead of source ones,
+	// the same as CopyOptions.NoPreserveMode does.
+	NoPreserveMode bool
+
+	// Set this to true to keep current modification times of copied entries instead of source ones.
+	NoPreserveModTime bool
+
+	// Set this to true to only plan actions without changing anything.
+	DryRun bool
+
+	// Set this to true to skip the final comparison of the directories.
+	NoVerify bool
+}
+
+// SyncDirs makes the destination directory match the source one and returns the performed actions.
+// See SyncDirsContext for details.
+func SyncDirs(src, dst string, opts SyncOptions) ([]SyncAction, error) {
+	return SyncDirsContext(context.Background(), src, dst, opts)
+}
+
+// SyncDirsContext makes the destination directory match the source one, like "rsync -a" does,
+// and returns the performed actions in the order of DiffDirs.
+// Both directories must exist.
+//
+// Entries are compared with opts.Compare, so added and changed ones are copied,
+// while extraneous ones are deleted only if opts.Delete is set.
+// Modification times of symbolic links are never synchronized.
+// Unless opts.NoVerify is set, the directories are compared again afterwards,
+// and an error is returned if they still differ.
+//
+// With opts.DryRun set, the planned actions are returned, but nothing is changed.
+// The context is checked between actions and file chunks, so a canceled sync may leave the destination
+// partially synchronized, but never with partially written files.
+func SyncDirsContext(ctx context.Context, src, dst string, opts SyncOptions) ([]SyncAction, error) {
+	compareOpts := opts.Compare
+
+	var actions []SyncAction
+
+	// Comparing the destination with the source makes diff kinds describe changes to apply.
+	if err := WalkDiffsContext(ctx, dst, src, compareOpts, func(diff Diff) error {
+		if kind, ok := syncActionKind(diff, opts.Delete); ok {
+			actions = append(actions, SyncAction{Kind: kind, Path: diff.Path, Diff: diff})
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return actions, nil
+	}
+
+	copier := &treeCopier{
+		ctx:             ctx,
+		overwrite:       OverwriteAlways,
+		followSymlinks:  !compareOpts.NoFollowSymlinks,
+		preserveMode:    !opts.NoPreserveMode,
+		preserveModTime: !opts.NoPreserveModTime,
+		preserveOwner:   compareOpts.CompareOwnership,
+		accepts:         compareOpts.accepts,
+	}
+
+	// Copying and deleting entries changes modification times of their parents,
+	// so metadata of directories is applied in the end, children first.
+	touchedDirs := make(map[string]bool)
+
+	for i, action := range actions {
+		if err := ctx.Err(); err != nil {
+			return actions[:i], err
+		}
+
+		if err := syncAction(copier, action, filepath.Join(dst, filepath.FromSlash(action.Path))); err != nil {
+			return actions[:i], err
+		}
+
+		if action.Kind == SyncUpdateMetadata && isDir(action.Diff.Item2) {
+			touchedDirs[action.Path] = true
+		} else {
+			touchedDirs[path.Dir(action.Path)] = true
+		}
+	}
+
+	if err := syncDirsMetadata(copier, src, dst, touchedDirs); err != nil {
+		return actions, err
+	}
+
+	if !opts.NoVerify {
+		if err := verifySync(ctx, src, dst, compareOpts, opts.Delete); err != nil {
+			return actions, err
+		}
+	}
+
+	return actions, nil
+}
+
+func syncActionKind(diff Diff, delete bool) (SyncActionKind, bool) {
+	switch diff.Kind {
+	case DiffKindAdded, DiffKindContentChanged:
+		return SyncCopy, true
+	case DiffKindRemoved:
+		return SyncDelete, delete
+	case DiffKindTypeChanged:
+		return SyncReplace, true
+	case DiffKindMetadataChanged:
+		return SyncUpdateMetadata, true
+	default:
+		return 0, false
+	}
+}
+
+func syncAction(copier *treeCopier, action SyncAction, dstPath string) error {
+	diff := action.Diff
+
+	switch action.Kind {
+	case SyncCopy:
+		return copier.copyEntry(diff.Item2.FullPath, dstPath, action.Path, diff.Item2)
+	case SyncReplace:
+		if err := os.RemoveAll(dstPath); err != nil {
+			return err
+		}
+
+		return copier.copyEntry(diff.Item2.FullPath, dstPath, action.Path, diff.Item2)
+	case SyncDelete:
+		return os.RemoveAll(dstPath)
+	case SyncUpdateMetadata:
+		if isDir(diff.Item2) {
+			// See syncDirsMetadata.
+			return nil
+		}
+
+		return copier.applyMetadata(dstPath, diff.Item2)
+	default:
+		return fmt.Errorf("unknown sync action: %v", action.Kind)
+	}
+}
+
+// Applies metadata of source directories to the touched destination ones, deepest first.
+func syncDirsMetadata(copier *treeCopier, src, dst string, touchedDirs map[string]bool) error {
+	rels := make([]string, 0, len(touchedDirs))
+	for rel := range touchedDirs {
+		rels = append(rels, rel)
+	}
+
+	sort.Slice(rels, func(i, j int) bool {
+		if depth1, depth2 := depth(rels[i]), depth(rels[j]); depth1 != depth2 {
+			return depth1 > depth2
+		}
+
+		return rels[i] < rels[j]
+	})
+
+	for _, rel := range rels {
+		info, err := copier.stat(filepath.Join(src, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+
+		if err := copier.applyMetadata(filepath.Join(dst, filepath.FromSlash(rel)), info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks that no diffs are left, except extraneous destination entries, if they are not deleted.
+func verifySync(ctx context.Context, src, dst string, opts CompareOptions, delete bool) error {
+	if delete {
+		if equal, err := DirsEqualContext(ctx, dst, src, opts); err != nil {
+			return err
+		} else if !equal {
+			return fmt.Errorf("directories differ after sync: %s, %s", src, dst)
+		}
+
+		return nil
+	}
+
+	return WalkDiffsContext(ctx, dst, src, opts, func(diff Diff) error {
+		if diff.Kind == DiffKindRemoved {
+			return nil
+		}
+
+		return fmt.Errorf("directories differ after sync: %s %v", diff.Path, diff.Kind)
+	})
+}
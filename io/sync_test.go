@@ -0,0 +1,142 @@
+package io
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncDirsC_DryRun(t *testing.T) {
+	actions, err := SyncDirs(diffPath("c2"), diffPath("c1"), SyncOptions{DryRun: true})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	var planned []string
+	for _, action := range actions {
+		planned = append(planned, action.String())
+	}
+
+	assert.Equal(t, []string{
+		"copy s1/S2",
+		"copy s1/s1/0.bin",
+		"copy s2",
+		"copy s4",
+		"copy s5/aa",
+		"copy s5/s0/1.bin",
+		"copy s5/s2/0.bin",
+		"copy s5/s2/1.bin",
+		"replace s5/s3/0.bin",
+		"copy s5/zz",
+		"copy s6",
+	}, planned)
+}
+
+func TestSyncDirsC(t *testing.T) {
+	dst := t.TempDir()
+	copyTestTree(t, diffPath("c1"), dst)
+
+	actions, err := SyncDirs(diffPath("c2"), dst, SyncOptions{Delete: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 15, len(actions))
+
+	equal, err := DirsEqual(diffPath("c2"), dst)
+	assert.Nil(t, err)
+	assert.True(t, equal)
+
+	actions, err = SyncDirs(diffPath("c2"), dst, SyncOptions{Delete: true})
+	assert.Nil(t, err)
+	assert.Empty(t, actions)
+}
+
+func TestSyncDirsC_NoDelete(t *testing.T) {
+	dst := t.TempDir()
+	copyTestTree(t, diffPath("c1"), dst)
+
+	_, err := SyncDirs(diffPath("c2"), dst, SyncOptions{})
+	assert.Nil(t, err)
+
+	diffs, err := DiffDirs(dst, diffPath("c2"))
+	assert.Nil(t, err)
+	assert.Equal(t, DiffCounts{DiffKindRemoved: 4}, CountDiffs(diffs))
+}
+
+func TestSyncDirs_Metadata(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	writeTestFile(t, filepath.Join(src, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "sub", "b.txt"), "b")
+	writeTestFile(t, filepath.Join(src, "sub", ".hidden"), "hidden")
+	writeTestFile(t, filepath.Join(dst, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(dst, ".keep"), "keep")
+
+	assert.Nil(t, os.Chmod(filepath.Join(src, "a.txt"), 0600))
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub", "."} {
+		assert.Nil(t, os.Chtimes(filepath.Join(src, name), modTime, modTime))
+	}
+
+	compareOpts := CompareOptions{ComparePermissions: true, CompareModTime: true, Hidden: HiddenExclude}
+
+	actions, err := SyncDirs(src, dst, SyncOptions{Compare: compareOpts, Delete: true})
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(actions)) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, SyncAction{Kind: SyncUpdateMetadata, Path: "a.txt"}, SyncAction{Kind: actions[0].Kind, Path: actions[0].Path})
+	assert.Equal(t, SyncAction{Kind: SyncCopy, Path: "sub"}, SyncAction{Kind: actions[1].Kind, Path: actions[1].Path})
+
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub", "."} {
+		info, err := os.Stat(filepath.Join(dst, name))
+		if assert.Nil(t, err) {
+			assert.True(t, modTime.Equal(info.ModTime()), name)
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dst, "a.txt"))
+		if assert.Nil(t, err) {
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		}
+	}
+
+	// Hidden entries are neither copied nor deleted.
+	exists, err := Exists(filepath.Join(dst, "sub", ".hidden"))
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	exists, err = Exists(filepath.Join(dst, ".keep"))
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestSyncDirsContext_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := SyncDirsContext(ctx, diffPath("c2"), t.TempDir(), SyncOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func copyTestTree(t *testing.T, src, dst string) {
+	t.Helper()
+
+	copier := &treeCopier{ctx: context.Background(), followSymlinks: true, preserveMode: true}
+
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, info := range infos {
+		if err := copier.copyEntry(filepath.Join(src, info.Name()), filepath.Join(dst, info.Name()), info.Name(), info); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package io
+
+import "os"
+
+func fileOwner(info os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
+
+func fileDevice(info os.FileInfo) (rdev uint64, ok bool) {
+	return 0, false
+}
+
+// Directories cannot be flushed portably on other systems, e.g. Windows, so durability of renames is up to them.
+func syncDir(path string) error {
+	return nil
+}
+
+func fileInode(info os.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	return 0, 0, 0, false
+}
+
+func fileAllocatedSize(info os.FileInfo) (size int64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package io
+
+// Renames across file systems cannot be told from other failures on other systems, e.g. Plan 9,
+// so they are not retried by copying.
+var errCrossDevice error
+
+func isCrossDevice(err error) bool {
+	return false
+}
@@ -0,0 +1,66 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package io
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func fileOwner(info os.FileInfo) (uid, gid uint32, ok bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Uid, stat.Gid, true
+	}
+
+	return 0, 0, false
+}
+
+func fileDevice(info os.FileInfo) (rdev uint64, ok bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Rdev), true
+	}
+
+	return 0, false
+}
+
+// Error of renames across file systems.
+var errCrossDevice error = syscall.EXDEV
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errCrossDevice)
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if err := dir.Sync(); err != nil {
+		closeQuietly(dir)
+		return err
+	}
+
+	return dir.Close()
+}
+
+// Returns the device and inode numbers, identifying the file, and the number of its hard links.
+func fileInode(info os.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev), uint64(stat.Ino), uint64(stat.Nlink), true
+	}
+
+	return 0, 0, 0, false
+}
+
+// Returns the size of disk blocks allocated for the file.
+func fileAllocatedSize(info os.FileInfo) (size int64, ok bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		// Blocks are always 512 bytes long, regardless of the block size of the file system.
+		return int64(stat.Blocks) * 512, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,13 @@
+package io
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows reports ERROR_NOT_SAME_DEVICE for renames across volumes, which is not defined by the syscall package.
+var errCrossDevice error = syscall.Errno(17)
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errCrossDevice) || errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,206 @@
+package io
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// tree gives access to entries of a compared directory tree, either on the OS file system or in fs.FS.
+type tree interface {
+	// Describes the entry, following symbolic links, if requested and supported.
+	stat(name string, follow bool) (os.FileInfo, error)
+
+	// Returns children of the directory sorted by names.
+	readDir(name string) ([]os.FileInfo, error)
+
+	open(name string) (io.ReadCloser, error)
+	readlink(name string) (string, error)
+	join(dir, name string) string
+
+	// Returns true iff names are OS paths, so they can be compared as absolute paths and cached by digest caches.
+	native() bool
+}
+
+var osFiles tree = osTree{}
+
+type osTree struct{}
+
+func (osTree) stat(name string, follow bool) (os.FileInfo, error) {
+	if follow {
+		return os.Stat(name)
+	}
+
+	return os.Lstat(name)
+}
+
+func (osTree) readDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (osTree) open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (osTree) readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (osTree) join(dir, name string) string {
+	return filepath.Join(dir, name)
+}
+
+func (osTree) native() bool {
+	return true
+}
+
+// fsTree is a tree in fs.FS, whose names are slash-separated and unrooted, see fs.ValidPath.
+// Symbolic links are supported only by file systems implementing the optional methods,
+// which os.DirFS and fstest.MapFS have in recent Go versions.
+type fsTree struct {
+	fsys fs.FS
+}
+
+func (t fsTree) stat(name string, follow bool) (os.FileInfo, error) {
+	if !follow {
+		if lstatFS, ok := t.fsys.(interface {
+			Lstat(name string) (fs.FileInfo, error)
+		}); ok {
+			return lstatFS.Lstat(name)
+		}
+	}
+
+	return fs.Stat(t.fsys, name)
+}
+
+func (t fsTree) readDir(name string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(t.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	// fs.ReadDir sorts entries, but some file systems may return them in another order via their own ReadDir.
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+func (t fsTree) open(name string) (io.ReadCloser, error) {
+	return t.fsys.Open(name)
+}
+
+func (t fsTree) readlink(name string) (string, error) {
+	if readLinkFS, ok := t.fsys.(interface {
+		ReadLink(name string) (string, error)
+	}); ok {
+		return readLinkFS.ReadLink(name)
+	}
+
+	return "", &PathError{Op: "readlink", Path: name, Err: ErrUnsupported}
+}
+
+func (t fsTree) join(dir, name string) string {
+	return path.Join(dir, name)
+}
+
+func (t fsTree) native() bool {
+	return false
+}
+
+func treeFileInfo(t tree, info os.FileInfo, fullPath string) *FileInfo {
+	fi := &FileInfo{FileInfo: info, FullPath: fullPath}
+
+	if !t.native() {
+		fi.tree = t
+	}
+
+	return fi
+}
+
+// Opens the file in its tree, so FullPath is not mistaken for an OS path.
+func (fi *FileInfo) open() (io.ReadCloser, error) {
+	if fi.tree != nil {
+		return fi.tree.open(fi.FullPath)
+	}
+
+	return os.Open(fi.FullPath)
+}
+
+func (fi *FileInfo) readFile() ([]byte, error) {
+	file, err := fi.open()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		closeQuietly(file)
+		return nil, err
+	}
+
+	return data, file.Close()
+}
+
+func validateFSRoots(root1, root2 string, opts *CompareOptions) error {
+	for _, root := range []string{root1, root2} {
+		if !fs.ValidPath(root) {
+			return &PathError{Op: "compare", Path: root, Err: fs.ErrInvalid}
+		}
+	}
+
+	return opts.validate()
+}
+
+// Returns true iff both paths are the same entry of the OS file system.
+func samePaths(tree1 tree, path1 string, tree2 tree, path2 string) (bool, error) {
+	if !tree1.native() || !tree2.native() {
+		return false, nil
+	}
+
+	return absolutePathsEqual(path1, path2)
+}
+
+func checkTreeDir(op string, t tree, path string) (*FileInfo, error) {
+	info, err := t.stat(path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isDir(info) {
+		return nil, errNotDir(op, path)
+	}
+
+	return treeFileInfo(t, info, path), nil
+}
+
+// Opens both files, closing the first one, if the second one fails to open.
+func openPair(tree1 tree, path1 string, tree2 tree, path2 string) (io.ReadCloser, io.ReadCloser, error) {
+	file1, err := tree1.open(path1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file2, err := tree2.open(path2)
+	if err != nil {
+		closeQuietly(file1)
+		return nil, nil, err
+	}
+
+	return file1, file2, nil
+}
@@ -0,0 +1,465 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DefaultContextLines   = 3
+	DefaultMaxUnifiedSize = 1 << 20
+
+	devNull = "/dev/null"
+
+	// Same as GNU diff uses in file headers.
+	unifiedTimeFormat = "2006-01-02 15:04:05.000000000 -0700"
+)
+
+type UnifiedOptions struct {
+	// Number of unchanged lines printed around changes, like -U of diff.
+	// Use a negative value to print no context lines.
+	// Zero means DefaultContextLines.
+	ContextLines int
+
+	// Files larger than this are not rendered, a short notice is printed instead.
+	// Zero or less means DefaultMaxUnifiedSize.
+	MaxSize int64
+}
+
+// UnifiedDiff renders the diff in the format of "diff -u", so the result can be applied by patch.
+// See WriteUnifiedDiff for details.
+func UnifiedDiff(diff Diff, opts UnifiedOptions) (string, error) {
+	var sb strings.Builder
+
+	if err := WriteUnifiedDiff(&sb, diff, opts); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+// WriteUnifiedDiff renders the diff in the format of "diff -u", so the result can be applied by patch.
+//
+// Added and removed files are compared against /dev/null.
+// Binary and too large files, files with too many changes to compare them quickly, as well as added and removed directories and type changes,
+// are described by a single line in the format of "diff -r".
+// Nothing is written for metadata changes and symbolic links.
+// Files are read the same way NewReport reads them.
+func WriteUnifiedDiff(w io.Writer, diff Diff, opts UnifiedOptions) error {
+	contextLines := opts.ContextLines
+	if contextLines < 0 {
+		contextLines = 0
+	} else if contextLines == 0 {
+		contextLines = DefaultContextLines
+	}
+
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxUnifiedSize
+	}
+
+	switch diff.Kind {
+	case DiffKindAdded:
+		if !isFile(diff.Item2) {
+			return writeOnlyIn(w, diff.Item2)
+		}
+	case DiffKindRemoved:
+		if !isFile(diff.Item1) {
+			return writeOnlyIn(w, diff.Item1)
+		}
+	case DiffKindTypeChanged:
+		_, err := fmt.Fprintf(w, "File %s is a %s while file %s is a %s\n",
+			diff.Item1.FullPath, describeType(diff.Item1), diff.Item2.FullPath, describeType(diff.Item2),
+		)
+		return err
+	case DiffKindContentChanged:
+		if !isFile(diff.Item1) || !isFile(diff.Item2) {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	label1, label2 := devNull, devNull
+	var data1, data2 []byte
+
+	if diff.Item1 != nil {
+		if diff.Item1.Size() > maxSize {
+			return writeTooLarge(w, diff)
+		}
+
+		var err error
+		if data1, err = diff.Item1.readFile(); err != nil {
+			return err
+		}
+
+		label1 = unifiedLabel(diff.Item1)
+	}
+
+	if diff.Item2 != nil {
+		if diff.Item2.Size() > maxSize {
+			return writeTooLarge(w, diff)
+		}
+
+		var err error
+		if data2, err = diff.Item2.readFile(); err != nil {
+			return err
+		}
+
+		label2 = unifiedLabel(diff.Item2)
+	}
+
+	if isBinary(data1) || isBinary(data2) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", diffItemPath(diff.Item1), diffItemPath(diff.Item2))
+		return err
+	}
+
+	lines1, lines2 := splitLines(data1), splitLines(data2)
+
+	edits, ok := diffLines(lines1, lines2)
+	if !ok {
+		_, err := fmt.Fprintf(w, "Files %s and %s differ (too many changes to compare)\n",
+			diffItemPath(diff.Item1), diffItemPath(diff.Item2),
+		)
+		return err
+	}
+
+	return writeUnified(w, label1, label2, lines1, lines2, edits, contextLines)
+}
+
+func writeOnlyIn(w io.Writer, info *FileInfo) error {
+	_, err := fmt.Fprintf(w, "Only in %s: %s\n", filepath.Dir(info.FullPath), info.Name())
+	return err
+}
+
+func writeTooLarge(w io.Writer, diff Diff) error {
+	_, err := fmt.Fprintf(w, "Files %s and %s differ (too large to compare)\n",
+		diffItemPath(diff.Item1), diffItemPath(diff.Item2),
+	)
+	return err
+}
+
+func diffItemPath(info *FileInfo) string {
+	if info == nil {
+		return devNull
+	}
+
+	return info.FullPath
+}
+
+func describeType(info os.FileInfo) string {
+	switch entryType(info) {
+	case EntryTypeFile:
+		if info.Size() == 0 {
+			return "regular empty file"
+		}
+		return "regular file"
+	case EntryTypeDir:
+		return "directory"
+	case EntryTypeSymlink:
+		return "symbolic link"
+	default:
+		return "special file"
+	}
+}
+
+func unifiedLabel(info *FileInfo) string {
+	return info.FullPath + "\t" + info.ModTime().Format(unifiedTimeFormat)
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:minInt(len(data), textProbeSize)], 0) >= 0
+}
+
+// Splits the data into lines, keeping line terminators, so that a missing final newline can be detected.
+func splitLines(data []byte) []string {
+	var lines []string
+
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i <= 0 {
+			i = len(data)
+		}
+
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
+	}
+
+	return lines
+}
+
+type editOp byte
+
+const (
+	editEqual  editOp = ' '
+	editDelete editOp = '-'
+	editInsert editOp = '+'
+)
+
+type edit struct {
+	op editOp
+
+	// Zero-based line indexes in the first and the second sequences.
+	// For inserted lines, index1 is the position of the insertion, and vice versa.
+	index1, index2 int
+}
+
+// Caps the work of diffLines, i.e. the number of edits times the number of lines,
+// so files with too many changes are reported as different without rendering hunks.
+const maxDiffCost = 1 << 26
+
+// Computes the shortest edit script turning lines1 into lines2 with the linear space variant of the Myers algorithm,
+// which splits the problem by middle snakes recursively.
+// Returns false, if the files have too many changes to compare them in reasonable time, see maxDiffCost.
+func diffLines(lines1, lines2 []string) ([]edit, bool) {
+	size := len(lines1) + len(lines2)
+
+	d := &differ{
+		a:       lines1,
+		b:       lines2,
+		forward: make([]int, size+3),
+		reverse: make([]int, size+3),
+		offset:  size/2 + 1,
+		edits:   make([]edit, 0, maxInt(len(lines1), len(lines2))),
+	}
+
+	if !d.compare(0, len(lines1), 0, len(lines2)) {
+		return nil, false
+	}
+
+	return d.edits, true
+}
+
+type differ struct {
+	a, b []string
+
+	// Furthest reaching x coordinates on diagonals of forward and reverse paths, shared by all subproblems,
+	// because every step reads only the values of the previous step.
+	forward, reverse []int
+	offset           int
+
+	edits []edit
+}
+
+func (d *differ) compare(lo1, hi1, lo2, hi2 int) bool {
+	// Trim the common prefix and suffix, which are usually most of the lines.
+	for lo1 < hi1 && lo2 < hi2 && d.a[lo1] == d.b[lo2] {
+		d.edits = append(d.edits, edit{op: editEqual, index1: lo1, index2: lo2})
+		lo1++
+		lo2++
+	}
+
+	suffix := 0
+	for lo1 < hi1-suffix && lo2 < hi2-suffix && d.a[hi1-1-suffix] == d.b[hi2-1-suffix] {
+		suffix++
+	}
+
+	hi1, hi2 = hi1-suffix, hi2-suffix
+
+	switch {
+	case lo1 == hi1:
+		for i := lo2; i < hi2; i++ {
+			d.edits = append(d.edits, edit{op: editInsert, index1: lo1, index2: i})
+		}
+	case lo2 == hi2:
+		for i := lo1; i < hi1; i++ {
+			d.edits = append(d.edits, edit{op: editDelete, index1: i, index2: lo2})
+		}
+	default:
+		// Both ends differ, so there are at least two edits, and both halves are strictly smaller.
+		x, y, u, v, ok := d.middleSnake(lo1, hi1, lo2, hi2)
+		if !ok || !d.compare(lo1, x, lo2, y) {
+			return false
+		}
+
+		for ; x < u; x, y = x+1, y+1 {
+			d.edits = append(d.edits, edit{op: editEqual, index1: x, index2: y})
+		}
+
+		if !d.compare(u, hi1, v, hi2) {
+			return false
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.edits = append(d.edits, edit{op: editEqual, index1: hi1 + i, index2: hi2 + i})
+	}
+
+	return true
+}
+
+// Finds the middle snake of an optimal path, i.e. the diagonal run from (x, y) to (u, v),
+// by searching forward from the start and backward from the end, until the paths overlap.
+func (d *differ) middleSnake(lo1, hi1, lo2, hi2 int) (x, y, u, v int, ok bool) {
+	n, m := hi1-lo1, hi2-lo2
+	delta := n - m
+	odd := delta%2 != 0
+	offset := d.offset
+	forward, reverse := d.forward, d.reverse
+
+	forward[offset+1], reverse[offset+1] = 0, 0
+
+	for depth := 0; depth <= (n+m+1)/2; depth++ {
+		if depth*(n+m) > maxDiffCost {
+			return 0, 0, 0, 0, false
+		}
+
+		for k := -depth; k <= depth; k += 2 {
+			var x int
+			if k == -depth || k != depth && forward[offset+k-1] < forward[offset+k+1] {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+
+			y := x - k
+			startX, startY := x, y
+
+			for x < n && y < m && d.a[lo1+x] == d.b[lo2+y] {
+				x++
+				y++
+			}
+
+			forward[offset+k] = x
+
+			// The reverse path of depth-1 edits on the same diagonal.
+			if rk := delta - k; odd && rk >= -(depth-1) && rk <= depth-1 && x+reverse[offset+rk] >= n {
+				return lo1 + startX, lo2 + startY, lo1 + x, lo2 + y, true
+			}
+		}
+
+		for k := -depth; k <= depth; k += 2 {
+			// Coordinates are distances from the ends.
+			var x int
+			if k == -depth || k != depth && reverse[offset+k-1] < reverse[offset+k+1] {
+				x = reverse[offset+k+1]
+			} else {
+				x = reverse[offset+k-1] + 1
+			}
+
+			y := x - k
+			startX, startY := x, y
+
+			for x < n && y < m && d.a[hi1-1-x] == d.b[hi2-1-y] {
+				x++
+				y++
+			}
+
+			reverse[offset+k] = x
+
+			// The forward path of depth edits on the same diagonal.
+			if fk := delta - k; !odd && fk >= -depth && fk <= depth && x+forward[offset+fk] >= n {
+				return hi1 - x, hi2 - y, hi1 - startX, hi2 - startY, true
+			}
+		}
+	}
+
+	// Unreachable, because the paths always overlap.
+	return 0, 0, 0, 0, false
+}
+
+func writeUnified(w io.Writer, label1, label2 string, lines1, lines2 []string, edits []edit, contextLines int) error {
+	bw := bufio.NewWriter(w)
+	headerWritten := false
+
+	for start := 0; start < len(edits); {
+		// Find the next change.
+		for start < len(edits) && edits[start].op == editEqual {
+			start++
+		}
+
+		if start >= len(edits) {
+			break
+		}
+
+		// Extend the hunk, while changes are separated by no more than two contexts.
+		end := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].op != editEqual {
+				end = i + 1
+			} else if i-end >= 2*contextLines {
+				break
+			}
+		}
+
+		hunkStart := maxInt(start-contextLines, 0)
+		hunkEnd := minInt(end+contextLines, len(edits))
+
+		if !headerWritten {
+			if _, err := fmt.Fprintf(bw, "--- %s\n+++ %s\n", label1, label2); err != nil {
+				return err
+			}
+
+			headerWritten = true
+		}
+
+		if err := writeHunk(bw, edits[hunkStart:hunkEnd], lines1, lines2); err != nil {
+			return err
+		}
+
+		start = hunkEnd
+	}
+
+	return bw.Flush()
+}
+
+func writeHunk(w *bufio.Writer, edits []edit, lines1, lines2 []string) error {
+	var count1, count2 int
+
+	for _, e := range edits {
+		if e.op != editInsert {
+			count1++
+		}
+		if e.op != editDelete {
+			count2++
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "@@ -%s +%s @@\n",
+		hunkRange(edits[0].index1, count1), hunkRange(edits[0].index2, count2),
+	); err != nil {
+		return err
+	}
+
+	for _, e := range edits {
+		line := ""
+		if e.op == editInsert {
+			line = lines2[e.index2]
+		} else {
+			line = lines1[e.index1]
+		}
+
+		if err := w.WriteByte(byte(e.op)); err != nil {
+			return err
+		}
+
+		if _, err := w.WriteString(line); err != nil {
+			return err
+		}
+
+		if !strings.HasSuffix(line, "\n") {
+			if _, err := w.WriteString("\n\\ No newline at end of file\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Formats a hunk range the way GNU diff does: an empty range refers to the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
@@ -0,0 +1,144 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff_Changed(t *testing.T) {
+	dir := t.TempDir()
+	path1, path2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt")
+	writeTestFile(t, path1, "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n")
+	writeTestFile(t, path2, "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk")
+
+	modTime := time.Date(2023, 1, 9, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{path1, path2} {
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info1, err := checkFileOrDir("stat", path1, false)
+	assert.Nil(t, err)
+	info2, err := checkFileOrDir("stat", path2, false)
+	assert.Nil(t, err)
+
+	diff := Diff{Kind: DiffKindContentChanged, Path: "1.txt", Item1: info1, Item2: info2}
+	header := "--- " + path1 + "\t" + modTime.Local().Format(unifiedTimeFormat) + "\n" +
+		"+++ " + path2 + "\t" + modTime.Local().Format(unifiedTimeFormat) + "\n"
+
+	unified, err := UnifiedDiff(diff, UnifiedOptions{ContextLines: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, header+
+		"@@ -1,4 +1,4 @@\n a\n-b\n+B\n c\n d\n"+
+		"@@ -9,2 +9,3 @@\n i\n j\n+k\n\\ No newline at end of file\n", unified)
+
+	unified, err = UnifiedDiff(diff, UnifiedOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, header+
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n"+
+		"@@ -8,3 +8,4 @@\n h\n i\n j\n+k\n\\ No newline at end of file\n", unified)
+
+	unified, err = UnifiedDiff(diff, UnifiedOptions{ContextLines: 4})
+	assert.Nil(t, err)
+	assert.Equal(t, header+
+		"@@ -1,10 +1,11 @@\n a\n-b\n+B\n c\n d\n e\n f\n g\n h\n i\n j\n+k\n\\ No newline at end of file\n", unified)
+
+	unified, err = UnifiedDiff(diff, UnifiedOptions{MaxSize: 8})
+	assert.Nil(t, err)
+	assert.Equal(t, "Files "+path1+" and "+path2+" differ (too large to compare)\n", unified)
+}
+
+func TestUnifiedDiffC_Kinds(t *testing.T) {
+	diffs, err := DiffDirs(diffPath("c1"), diffPath("c2"))
+	if !assert.Nil(t, err) || !assert.Equal(t, 15, len(diffs)) {
+		t.FailNow()
+	}
+
+	unified, err := UnifiedDiff(diffs[0], UnifiedOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Only in "+diffPath("c1")+": s0\n", unified)
+
+	unified, err = UnifiedDiff(diffs[2], UnifiedOptions{MaxSize: 10 << 20})
+	assert.Nil(t, err)
+	assert.Equal(t, "Binary files "+diffPath("c1/s1/s1/0.bin")+" and "+diffPath("c2/s1/s1/0.bin")+" differ\n", unified)
+
+	unified, err = UnifiedDiff(diffs[12], UnifiedOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "File "+diffPath("c1/s5/s3/0.bin")+" is a regular file while file "+
+		diffPath("c2/s5/s3/0.bin")+" is a directory\n", unified)
+}
+
+func TestUnifiedDiff_Added(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "new.txt"), "x\ny\n")
+
+	info, err := checkFileOrDir("stat", filepath.Join(dir, "new.txt"), false)
+	assert.Nil(t, err)
+
+	unified, err := UnifiedDiff(Diff{Kind: DiffKindAdded, Path: "new.txt", Item2: info}, UnifiedOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "--- /dev/null\n+++ "+unifiedLabel(info)+"\n@@ -0,0 +1,2 @@\n+x\n+y\n", unified)
+}
+
+func TestUnifiedDiff_Dissimilar(t *testing.T) {
+	dir := t.TempDir()
+	path1, path2 := filepath.Join(dir, "1.txt"), filepath.Join(dir, "2.txt")
+
+	// Every line differs, so the edit distance is the total number of lines.
+	writeTestFile(t, path1, strings.Repeat("a\n", 4000))
+	writeTestFile(t, path2, strings.Repeat("b\n", 4000))
+
+	info1, err := checkFileOrDir("stat", path1, false)
+	assert.Nil(t, err)
+	info2, err := checkFileOrDir("stat", path2, false)
+	assert.Nil(t, err)
+
+	diff := Diff{Kind: DiffKindContentChanged, Path: "1.txt", Item1: info1, Item2: info2}
+
+	unified, err := UnifiedDiff(diff, UnifiedOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 8000, strings.Count(unified, "\n-a")+strings.Count(unified, "\n+b"))
+	assert.True(t, strings.Contains(unified, "@@ -1,4000 +1,4000 @@\n"))
+
+	writeTestFile(t, path1, strings.Repeat("a\n", 500000))
+	writeTestFile(t, path2, strings.Repeat("b\n", 500000))
+
+	info1, err = checkFileOrDir("stat", path1, false)
+	assert.Nil(t, err)
+	info2, err = checkFileOrDir("stat", path2, false)
+	assert.Nil(t, err)
+
+	diff = Diff{Kind: DiffKindContentChanged, Path: "1.txt", Item1: info1, Item2: info2}
+
+	unified, err = UnifiedDiff(diff, UnifiedOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "Files "+path1+" and "+path2+" differ (too many changes to compare)\n", unified)
+}
+
+func TestUnifiedDiff_FS(t *testing.T) {
+	fsys1 := fstest.MapFS{
+		"a.txt":       {Data: []byte("a\n")},
+		"removed.txt": {Data: []byte("removed\n")},
+	}
+
+	fsys2 := fstest.MapFS{
+		"a.txt": {Data: []byte("A\n")},
+	}
+
+	diffs, err := DiffFS(fsys1, ".", fsys2, ".")
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(diffs)) {
+		t.FailNow()
+	}
+
+	var patch strings.Builder
+	assert.Nil(t, WritePatch(&patch, diffs, UnifiedOptions{}))
+	assert.Contains(t, patch.String(), "@@ -1 +1 @@\n-a\n+A\n")
+	assert.Contains(t, patch.String(), "@@ -1 +0,0 @@\n-removed\n")
+}